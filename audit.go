@@ -0,0 +1,316 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	// auditLogMode is the mode used to create the audit log file.
+	auditLogMode = os.FileMode(0600)
+
+	// auditLogDirMode is the mode used to create the directory to
+	// hold the audit log.
+	auditLogDirMode = os.FileMode(0750)
+
+	// auditLogFlags are the flags used to open the audit log file.
+	// The file is opened for reading too since the last entry must
+	// be read when hash chaining is enabled.
+	auditLogFlags = (os.O_CREATE | os.O_RDWR | os.O_APPEND | os.O_SYNC)
+
+	// auditResultSuccess and auditResultFailure are the values of
+	// the result field of an audit entry.
+	auditResultSuccess = "success"
+	auditResultFailure = "failure"
+
+	// auditActionSignalPrefix and auditActionStopPod are the actions
+	// recorded for a kill operation: each signal actually sent to the
+	// container and the pod VM being stopped.
+	auditActionSignalPrefix = "signal "
+	auditActionStopPod      = "stop-pod"
+)
+
+// variables to allow tests to modify the values
+var (
+	procLoginUID = "/proc/self/loginuid"
+	procCommFmt  = "/proc/%d/comm"
+)
+
+// ccAudit is the audit log for state-changing operations. It is nil if
+// auditing is not enabled.
+var ccAudit *auditLog
+
+// auditLog is an append-only log recording who performed which
+// state-changing operations on which containers.
+type auditLog struct {
+	path      string
+	hashChain bool
+}
+
+// auditEntry is a single audit log record. Entries are written to
+// the audit log as JSON lines.
+//
+// If hash chaining is enabled, PrevHash is the Hash of the previous
+// entry in the log and Hash is the hex-encoded SHA-256 of the entry
+// serialised without the Hash field. Modifying, inserting or removing
+// an entry therefore breaks the chain.
+type auditEntry struct {
+	Time          time.Time `json:"time"`
+	Command       string    `json:"command"`
+	ContainerID   string    `json:"containerID"`
+	PodID         string    `json:"podID,omitempty"`
+	Args          []string  `json:"args,omitempty"`
+	Signal        string    `json:"signal,omitempty"`
+	Actions       []string  `json:"actions,omitempty"`
+	UID           int       `json:"uid"`
+	GID           int       `json:"gid"`
+	LoginUID      string    `json:"loginUID,omitempty"`
+	PID           int       `json:"pid"`
+	ParentPID     int       `json:"ppid"`
+	ParentCommand string    `json:"parentCommand,omitempty"`
+	Result        string    `json:"result"`
+	Error         string    `json:"error,omitempty"`
+	PrevHash      string    `json:"prevHash,omitempty"`
+	Hash          string    `json:"hash,omitempty"`
+}
+
+// handleAuditLog sets up the audit log. If the path is blank, auditing
+// is disabled.
+func handleAuditLog(path string, hashChain bool) error {
+	if path == "" {
+		ccAudit = nil
+		return nil
+	}
+
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("Audit log path must be absolute: %v", path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), auditLogDirMode); err != nil {
+		return err
+	}
+
+	ccAudit = &auditLog{
+		path:      path,
+		hashChain: hashChain,
+	}
+
+	return nil
+}
+
+// newAuditEntry creates an audit entry for the specified command,
+// filling in the details of the caller.
+func newAuditEntry(command, containerID string) *auditEntry {
+	ppid := os.Getppid()
+
+	entry := &auditEntry{
+		Command:     command,
+		ContainerID: containerID,
+		UID:         os.Getuid(),
+		GID:         os.Getgid(),
+		PID:         os.Getpid(),
+		ParentPID:   ppid,
+	}
+
+	if loginUID, err := getFileContents(procLoginUID); err == nil {
+		entry.LoginUID = strings.TrimSpace(loginUID)
+	}
+
+	if comm, err := getFileContents(fmt.Sprintf(procCommFmt, ppid)); err == nil {
+		entry.ParentCommand = strings.TrimSpace(comm)
+	}
+
+	return entry
+}
+
+// finish records the result of the operation described by the audit
+// entry in the audit log (if enabled).
+//
+// An exit error only forwards the exit code of a foreground process
+// so is not considered a failure of the operation.
+//
+// Failure to write the audit log is logged but does not cause the
+// operation itself to fail since it has already been performed.
+func (entry *auditEntry) finish(opErr error) {
+	if ccAudit == nil {
+		return
+	}
+
+	entry.Time = time.Now().UTC()
+	entry.Result = auditResultSuccess
+
+	if _, ok := opErr.(*cli.ExitError); ok {
+		opErr = nil
+	}
+
+	if opErr != nil {
+		entry.Result = auditResultFailure
+		entry.Error = opErr.Error()
+	}
+
+	if err := ccAudit.write(entry); err != nil {
+		ccLog.Errorf("Failed to write audit log %v: %v", ccAudit.path, err)
+	}
+}
+
+// write appends the entry to the audit log. The audit log is locked
+// for the duration of the write to serialise concurrent runtimes
+// (which is required to maintain the hash chain).
+func (a *auditLog) write(entry *auditEntry) error {
+	f, err := os.OpenFile(a.path, auditLogFlags, auditLogMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	if a.hashChain {
+		last, err := lastAuditEntry(f)
+		if err != nil {
+			return err
+		}
+
+		entry.PrevHash = ""
+		if last != nil {
+			entry.PrevHash = last.Hash
+		}
+
+		entry.Hash, err = entry.hash()
+		if err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(line, '\n'))
+
+	return err
+}
+
+// hash returns the hash of the entry used for hash chaining.
+func (entry auditEntry) hash() (string, error) {
+	entry.Hash = ""
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lastAuditEntry returns the last entry of the audit log, or nil if
+// the log is empty.
+func lastAuditEntry(f *os.File) (*auditEntry, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := st.Size()
+	if size == 0 {
+		return nil, nil
+	}
+
+	// Read backwards from the end of the file until the start of the
+	// last line has been found.
+	const chunkSize = 4096
+
+	var data []byte
+	offset := size
+
+	for offset > 0 {
+		n := int64(chunkSize)
+		if offset < n {
+			n = offset
+		}
+
+		offset -= n
+
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		data = append(buf, data...)
+
+		trimmed := bytes.TrimRight(data, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			data = trimmed[i+1:]
+			break
+		}
+
+		if offset == 0 {
+			data = trimmed
+		}
+	}
+
+	var entry auditEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("Invalid last entry in audit log %v: %v", f.Name(), err)
+	}
+
+	return &entry, nil
+}
+
+// recordSignal records that the signal has been sent to the container.
+// The signal of the entry is the last signal actually sent.
+func (entry *auditEntry) recordSignal(signum syscall.Signal) {
+	name := signalName(signum)
+	if name == "" {
+		name = strconv.Itoa(int(signum))
+	}
+
+	entry.Signal = name
+	entry.Actions = append(entry.Actions, auditActionSignalPrefix+name)
+}
+
+// auditSignal returns the signal in the form it will be recorded in
+// the audit log.
+func auditSignal(signal string) string {
+	if _, err := strconv.Atoi(signal); err == nil {
+		return signal
+	}
+
+	if !strings.HasPrefix(signal, "SIG") {
+		return "SIG" + signal
+	}
+
+	return signal
+}
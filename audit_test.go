@@ -0,0 +1,269 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+const (
+	testAuditContainerID = "audit-container"
+	testAuditPodID       = "audit-pod"
+)
+
+func readTestAuditLog(t *testing.T, path string) []auditEntry {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var entries []auditEntry
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		var entry auditEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		assert.NoError(t, err)
+
+		entries = append(entries, entry)
+	}
+
+	assert.NoError(t, scanner.Err())
+
+	return entries
+}
+
+// verifyTestAuditChain returns an error if the hash chain of the
+// specified entries is broken.
+func verifyTestAuditChain(entries []auditEntry) error {
+	prev := ""
+
+	for i, entry := range entries {
+		if entry.PrevHash != prev {
+			return fmt.Errorf("entry %d: expected previous hash %q, got %q", i, prev, entry.PrevHash)
+		}
+
+		hash, err := entry.hash()
+		if err != nil {
+			return err
+		}
+
+		if entry.Hash != hash {
+			return fmt.Errorf("entry %d: expected hash %q, got %q", i, hash, entry.Hash)
+		}
+
+		prev = entry.Hash
+	}
+
+	return nil
+}
+
+func TestHandleAuditLog(t *testing.T) {
+	assert := assert.New(t)
+
+	savedAudit := ccAudit
+	defer func() {
+		ccAudit = savedAudit
+	}()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	err = handleAuditLog("", true)
+	assert.NoError(err)
+	assert.Nil(ccAudit)
+
+	err = handleAuditLog("audit.log", true)
+	assert.Error(err)
+	assert.Nil(ccAudit)
+
+	path := filepath.Join(tmpdir, "a", "b", "audit.log")
+
+	err = handleAuditLog(path, true)
+	assert.NoError(err)
+	assert.NotNil(ccAudit)
+	assert.Equal(path, ccAudit.path)
+	assert.True(ccAudit.hashChain)
+	assert.True(fileExists(filepath.Dir(path)))
+}
+
+func TestNewAuditEntry(t *testing.T) {
+	assert := assert.New(t)
+
+	savedLoginUID := procLoginUID
+	defer func() {
+		procLoginUID = savedLoginUID
+	}()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	procLoginUID = filepath.Join(tmpdir, "loginuid")
+	err = ioutil.WriteFile(procLoginUID, []byte("1234"), testFileMode)
+	assert.NoError(err)
+
+	entry := newAuditEntry("start", testAuditContainerID)
+	assert.Equal("start", entry.Command)
+	assert.Equal(testAuditContainerID, entry.ContainerID)
+	assert.Equal(os.Getuid(), entry.UID)
+	assert.Equal(os.Getgid(), entry.GID)
+	assert.Equal(os.Getpid(), entry.PID)
+	assert.Equal(os.Getppid(), entry.ParentPID)
+	assert.Equal("1234", entry.LoginUID)
+}
+
+func TestAuditEntryFinish(t *testing.T) {
+	assert := assert.New(t)
+
+	savedAudit := ccAudit
+	defer func() {
+		ccAudit = savedAudit
+	}()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	path := filepath.Join(tmpdir, "audit.log")
+
+	// auditing disabled
+	err = handleAuditLog("", false)
+	assert.NoError(err)
+
+	newAuditEntry("create", testAuditContainerID).finish(nil)
+	assert.False(fileExists(path))
+
+	err = handleAuditLog(path, false)
+	assert.NoError(err)
+
+	entry := newAuditEntry("exec", testAuditContainerID)
+	entry.PodID = testAuditPodID
+	entry.Args = []string{"/bin/sh", "-c", "echo hello"}
+	entry.finish(nil)
+
+	entry = newAuditEntry("kill", testAuditContainerID)
+	entry.Signal = auditSignal("KILL")
+	entry.finish(errors.New("kill failed"))
+
+	// a foreground process exit code is not an operation failure
+	newAuditEntry("exec", testAuditContainerID).finish(cli.NewExitError("", 3))
+
+	st, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(auditLogMode, st.Mode().Perm())
+
+	entries := readTestAuditLog(t, path)
+	assert.Len(entries, 3)
+
+	assert.Equal("exec", entries[0].Command)
+	assert.Equal(testAuditContainerID, entries[0].ContainerID)
+	assert.Equal(testAuditPodID, entries[0].PodID)
+	assert.Equal([]string{"/bin/sh", "-c", "echo hello"}, entries[0].Args)
+	assert.Equal(auditResultSuccess, entries[0].Result)
+	assert.Empty(entries[0].Error)
+	assert.Empty(entries[0].Hash)
+	assert.False(entries[0].Time.IsZero())
+
+	assert.Equal("kill", entries[1].Command)
+	assert.Equal("SIGKILL", entries[1].Signal)
+	assert.Equal(auditResultFailure, entries[1].Result)
+	assert.Equal("kill failed", entries[1].Error)
+
+	assert.Equal(auditResultSuccess, entries[2].Result)
+}
+
+func TestAuditLogHashChain(t *testing.T) {
+	assert := assert.New(t)
+
+	savedAudit := ccAudit
+	defer func() {
+		ccAudit = savedAudit
+	}()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	path := filepath.Join(tmpdir, "audit.log")
+
+	err = handleAuditLog(path, true)
+	assert.NoError(err)
+
+	for i := 0; i < 5; i++ {
+		entry := newAuditEntry("exec", testAuditContainerID)
+
+		// ensure the last entry has to be found across multiple
+		// reads.
+		entry.Args = []string{strings.Repeat("x", 5000), fmt.Sprintf("%d", i)}
+		entry.finish(nil)
+	}
+
+	entries := readTestAuditLog(t, path)
+	assert.Len(entries, 5)
+	assert.Empty(entries[0].PrevHash)
+	assert.NoError(verifyTestAuditChain(entries))
+
+	// modifying an entry breaks the chain
+	tampered := make([]auditEntry, len(entries))
+	copy(tampered, entries)
+	tampered[2].UID = 12345
+	assert.Error(verifyTestAuditChain(tampered))
+
+	// removing an entry breaks the chain
+	removed := append([]auditEntry{}, entries[:2]...)
+	removed = append(removed, entries[3:]...)
+	assert.Error(verifyTestAuditChain(removed))
+}
+
+func TestLastAuditEntryInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	path := filepath.Join(tmpdir, "audit.log")
+	err = ioutil.WriteFile(path, []byte("not json\n"), testFileMode)
+	assert.NoError(err)
+
+	f, err := os.Open(path)
+	assert.NoError(err)
+	defer f.Close()
+
+	_, err = lastAuditEntry(f)
+	assert.Error(err)
+}
+
+func TestAuditSignal(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("SIGKILL", auditSignal("KILL"))
+	assert.Equal("SIGTERM", auditSignal("SIGTERM"))
+	assert.Equal("9", auditSignal("9"))
+}
@@ -607,7 +607,7 @@ func TestCCCheckCLIFunction(t *testing.T) {
 
 	assert.False(t, fileExists(logfile))
 
-	err = handleGlobalLog(logfile)
+	err = handleGlobalLog(logfile, logRotation{})
 	assert.NoError(t, err)
 
 	setupCheckHostIsClearContainersCapable(t, cpuInfoFile, cpuData, moduleData)
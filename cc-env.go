@@ -31,7 +31,7 @@ import (
 //
 // XXX: Increment for every change to the output format
 // (meaning any change to the EnvInfo type).
-const formatVersion = "1.0.2"
+const formatVersion = "1.0.3"
 
 // defaultOutputFile is the default output file to write the gathered
 // information to.
@@ -72,6 +72,15 @@ type RuntimeConfigInfo struct {
 type RuntimeInfo struct {
 	Version RuntimeVersionInfo
 	Config  RuntimeConfigInfo
+	State   RuntimeStateInfo
+}
+
+// RuntimeStateInfo stores details of the stored pods and containers state.
+type RuntimeStateInfo struct {
+	Storage string
+	// Version of the state format, which has to be supported by all
+	// the runtimes accessing the same containers.
+	Version int
 }
 
 // RuntimeVersionInfo stores details of the runtime version
@@ -161,9 +170,15 @@ func getRuntimeInfo(configFile, logFile string, config oci.RuntimeConfig) Runtim
 		},
 	}
 
+	runtimeState := RuntimeStateInfo{
+		Storage: ccStorageType.String(),
+		Version: vc.StateFormatVersion,
+	}
+
 	return RuntimeInfo{
 		Version: runtimeVersion,
 		Config:  runtimeConfig,
+		State:   runtimeState,
 	}
 }
 
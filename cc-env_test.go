@@ -287,6 +287,10 @@ func getExpectedRuntimeDetails(configFile, logFile string) RuntimeInfo {
 				Resolved: configFile,
 			},
 		},
+		State: RuntimeStateInfo{
+			Storage: string(vc.FilesystemStorage),
+			Version: vc.StateFormatVersion,
+		},
 	}
 }
 
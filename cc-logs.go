@@ -0,0 +1,225 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// podLogFollowInterval is how often the pod logs are checked for new
+// data when following them.
+var podLogFollowInterval = 250 * time.Millisecond
+
+var errPodLogsDisabled = errors.New("Pod logs are not enabled (see pod_log_dir in the configuration file)")
+
+var logsCLICommand = cli.Command{
+	Name:  "cc-logs",
+	Usage: "display the console, shim and runtime logs of a pod",
+	ArgsUsage: `<container-id>
+
+   <container-id> is the name for the instance of the container, or the
+   ID of a deleted pod whose logs have been retained.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "follow, f",
+			Usage: "follow the logs as they are written",
+		},
+		cli.StringFlag{
+			Name:  "type, t",
+			Value: strings.Join(podLogTypes(podLogFiles), ","),
+			Usage: "comma-separated list of the logs to display",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		containerID := context.Args().First()
+		if containerID == "" {
+			return fmt.Errorf("Missing container ID")
+		}
+
+		dir, err := podLogDir(containerID)
+		if err != nil {
+			return err
+		}
+
+		paths, err := podLogPaths(dir, context.String("type"))
+		if err != nil {
+			return err
+		}
+
+		if context.Bool("follow") {
+			return followPodLogs(os.Stdout, paths, podLogFollowInterval, nil)
+		}
+
+		return printPodLogs(os.Stdout, paths)
+	},
+}
+
+// podLogTypes returns the log types corresponding to the specified
+// pod log file names.
+func podLogTypes(files []string) []string {
+	var types []string
+
+	for _, file := range files {
+		types = append(types, strings.TrimSuffix(file, filepath.Ext(file)))
+	}
+
+	return types
+}
+
+// podLogDir returns the log directory of the pod the specified
+// container belongs to.
+func podLogDir(containerID string) (string, error) {
+	if ccPodLog == nil {
+		return "", errPodLogsDisabled
+	}
+
+	status, podID, err := getContainerInfo(containerID)
+	if err != nil {
+		return "", err
+	}
+
+	if status.ID == "" {
+		// The logs of deleted pods are found using the pod ID.
+		podID = containerID
+	}
+
+	dir := ccPodLog.podDir(podID)
+	if !fileExists(dir) {
+		return "", fmt.Errorf("No logs found for container %v", containerID)
+	}
+
+	return dir, nil
+}
+
+// podLogPaths returns the paths of the logs of the specified types in
+// the pod log directory.
+func podLogPaths(dir, types string) ([]string, error) {
+	var paths []string
+
+	for _, t := range strings.Split(types, ",") {
+		t = strings.TrimSpace(t)
+
+		found := false
+		for _, file := range podLogFiles {
+			if t == strings.TrimSuffix(file, filepath.Ext(file)) {
+				paths = append(paths, filepath.Join(dir, file))
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("Invalid log type %q (expected one of %v)", t,
+				strings.Join(podLogTypes(podLogFiles), ", "))
+		}
+	}
+
+	return paths, nil
+}
+
+// printPodLogs writes the contents of the specified logs to w. If more
+// than one log is specified, each is preceded by a header.
+func printPodLogs(w io.Writer, paths []string) error {
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if len(paths) > 1 {
+			fmt.Fprintf(w, "==> %s <==\n", path)
+		}
+
+		_, err = io.Copy(w, f)
+		f.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// followPodLogs writes the contents of the specified logs to w and
+// then writes any data subsequently appended to them, checking for new
+// data at the specified interval until done is closed. If more than
+// one log is specified, a header is written whenever the log being
+// displayed changes.
+func followPodLogs(w io.Writer, paths []string, interval time.Duration, done <-chan struct{}) error {
+	offsets := make(map[string]int64)
+	last := ""
+
+	for {
+		for _, path := range paths {
+			f, err := os.Open(path)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			st, err := f.Stat()
+			if err != nil {
+				f.Close()
+				return err
+			}
+
+			offset := offsets[path]
+			if st.Size() < offset {
+				// log was truncated
+				offset = 0
+			}
+
+			if st.Size() > offset {
+				if len(paths) > 1 && path != last {
+					if last != "" {
+						fmt.Fprintln(w)
+					}
+
+					fmt.Fprintf(w, "==> %s <==\n", path)
+					last = path
+				}
+
+				n, err := io.Copy(w, io.NewSectionReader(f, offset, st.Size()-offset))
+				offset += n
+
+				if err != nil {
+					f.Close()
+					return err
+				}
+			}
+
+			offsets[path] = offset
+			f.Close()
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
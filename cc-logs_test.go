@@ -0,0 +1,166 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer that can be written and read
+// concurrently.
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.buf.String()
+}
+
+func TestPodLogTypes(t *testing.T) {
+	assert.Equal(t, []string{"console", "shim", "runtime"}, podLogTypes(podLogFiles))
+}
+
+func TestPodLogPaths(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := "/pod/logs"
+
+	paths, err := podLogPaths(dir, "console")
+	assert.NoError(err)
+	assert.Equal([]string{filepath.Join(dir, podConsoleLog)}, paths)
+
+	paths, err = podLogPaths(dir, "runtime, shim")
+	assert.NoError(err)
+	assert.Equal([]string{filepath.Join(dir, podRuntimeLog), filepath.Join(dir, podShimLog)}, paths)
+
+	_, err = podLogPaths(dir, "console,foo")
+	assert.Error(err)
+}
+
+func TestPodLogDirDisabled(t *testing.T) {
+	defer saveTestPodLog()()
+
+	ccPodLog = nil
+
+	_, err := podLogDir(testPodLogPodID)
+	assert.Equal(t, errPodLogsDisabled, err)
+}
+
+func TestPrintPodLogs(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	console := filepath.Join(tmpdir, podConsoleLog)
+	shim := filepath.Join(tmpdir, podShimLog)
+	runtime := filepath.Join(tmpdir, podRuntimeLog)
+
+	err = ioutil.WriteFile(console, []byte("console output\n"), testFileMode)
+	assert.NoError(err)
+	err = ioutil.WriteFile(runtime, []byte("runtime output\n"), testFileMode)
+	assert.NoError(err)
+
+	var b bytes.Buffer
+
+	// a single log is displayed without a header
+	err = printPodLogs(&b, []string{console})
+	assert.NoError(err)
+	assert.Equal("console output\n", b.String())
+
+	// missing logs are ignored
+	b.Reset()
+	err = printPodLogs(&b, []string{console, shim, runtime})
+	assert.NoError(err)
+
+	expected := "==> " + console + " <==\nconsole output\n" +
+		"==> " + runtime + " <==\nruntime output\n"
+	assert.Equal(expected, b.String())
+}
+
+func TestFollowPodLogs(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	console := filepath.Join(tmpdir, podConsoleLog)
+	runtime := filepath.Join(tmpdir, podRuntimeLog)
+
+	err = ioutil.WriteFile(console, []byte("boot\n"), testFileMode)
+	assert.NoError(err)
+
+	var b syncBuffer
+	done := make(chan struct{})
+	result := make(chan error)
+
+	go func() {
+		result <- followPodLogs(&b, []string{console, runtime}, 10*time.Millisecond, done)
+	}()
+
+	waitForOutput := func(s string) {
+		for i := 0; i < 500; i++ {
+			if strings.Contains(b.String(), s) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("output %q not found in %q", s, b.String())
+	}
+
+	waitForOutput("boot\n")
+
+	// a log created after following started is displayed
+	err = ioutil.WriteFile(runtime, []byte("created\n"), testFileMode)
+	assert.NoError(err)
+	waitForOutput("created\n")
+
+	f, err := os.OpenFile(console, os.O_WRONLY|os.O_APPEND, testFileMode)
+	assert.NoError(err)
+	_, err = f.WriteString("login\n")
+	assert.NoError(err)
+	f.Close()
+	waitForOutput("login\n")
+
+	close(done)
+	assert.NoError(<-result)
+
+	expected := "==> " + console + " <==\nboot\n" +
+		"\n==> " + runtime + " <==\ncreated\n" +
+		"\n==> " + console + " <==\nlogin\n"
+	assert.Equal(expected, b.String())
+}
@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	goruntime "runtime"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	vc "github.com/containers/virtcontainers"
@@ -60,6 +61,16 @@ const (
 	hyperstartAgentTableType = "hyperstart"
 )
 
+// defaultGlobalLogMaxFiles is the number of rotated global log files
+// kept if global log rotation is enabled but the number of files to
+// keep is not specified.
+const defaultGlobalLogMaxFiles = 5
+
+// defaultPodLogRetention is how long the logs of a pod are kept after
+// the pod has been deleted if per-pod logs are enabled but the
+// retention period is not specified.
+const defaultPodLogRetention = 24 * time.Hour
+
 var (
 	errUnknownHypervisor = errors.New("unknown hypervisor")
 	errUnknownAgent      = errors.New("unknown agent")
@@ -89,7 +100,18 @@ type proxy struct {
 }
 
 type runtime struct {
-	GlobalLogPath string `toml:"global_log_path"`
+	GlobalLogPath     string  `toml:"global_log_path"`
+	GlobalLogMaxSize  uint32  `toml:"global_log_max_size"`
+	GlobalLogMaxFiles *uint32 `toml:"global_log_max_files"`
+	GlobalLogCompress bool    `toml:"global_log_compress"`
+	LogBackend        string  `toml:"log_backend"`
+	AuditLogPath      string  `toml:"audit_log_path"`
+	AuditLogHashChain bool    `toml:"audit_log_hash_chain"`
+	PodLogDir         string  `toml:"pod_log_dir"`
+	PodLogRetention   string  `toml:"pod_log_retention"`
+	TraceEndpoint     string  `toml:"trace_endpoint"`
+	TraceFile         string  `toml:"trace_file"`
+	Storage           string  `toml:"storage"`
 }
 
 type shim struct {
@@ -178,6 +200,63 @@ func (s shim) path() string {
 	return s.Path
 }
 
+func (r runtime) logBackend() (string, error) {
+	switch r.LogBackend {
+	case "":
+		return fileLogBackend, nil
+	case fileLogBackend, syslogLogBackend, journaldLogBackend:
+		return r.LogBackend, nil
+	}
+
+	return "", fmt.Errorf("unknown log backend %q", r.LogBackend)
+}
+
+func (r runtime) logRotation() logRotation {
+	// Zero is a valid number of files to keep (the global log is then
+	// simply removed once it reaches its maximum size), so the default
+	// only applies when the option is not specified.
+	maxFiles := defaultGlobalLogMaxFiles
+	if r.GlobalLogMaxFiles != nil {
+		maxFiles = int(*r.GlobalLogMaxFiles)
+	}
+
+	return logRotation{
+		maxSize:  int64(r.GlobalLogMaxSize) * 1024 * 1024, // MiB
+		maxFiles: maxFiles,
+		compress: r.GlobalLogCompress,
+	}
+}
+
+func (r runtime) podLogRetention() (time.Duration, error) {
+	if r.PodLogRetention == "" {
+		return defaultPodLogRetention, nil
+	}
+
+	retention, err := time.ParseDuration(r.PodLogRetention)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pod log retention %q: %v", r.PodLogRetention, err)
+	}
+
+	if retention < 0 {
+		return 0, fmt.Errorf("invalid pod log retention %q: cannot be negative", r.PodLogRetention)
+	}
+
+	return retention, nil
+}
+
+func (r runtime) storage() (vc.StorageType, error) {
+	if r.Storage == "" {
+		return vc.FilesystemStorage, nil
+	}
+
+	var storageType vc.StorageType
+	if err := storageType.Set(r.Storage); err != nil {
+		return "", fmt.Errorf("unknown storage %q", r.Storage)
+	}
+
+	return storageType, nil
+}
+
 func (a agent) pauseRootPath() string {
 	if a.PauseRootPath == "" {
 		return defaultPauseRootPath
@@ -359,10 +438,40 @@ func loadConfiguration(configPath string, ignoreLogging bool) (resolvedConfigPat
 
 	logfilePath = tomlConf.Runtime.GlobalLogPath
 
+	logBackend, err := tomlConf.Runtime.logBackend()
+	if err != nil {
+		return "", "", config, fmt.Errorf("%v: %v", resolved, err)
+	}
+
+	podLogRetention, err := tomlConf.Runtime.podLogRetention()
+	if err != nil {
+		return "", "", config, fmt.Errorf("%v: %v", resolved, err)
+	}
+
+	storageType, err := tomlConf.Runtime.storage()
+	if err != nil {
+		return "", "", config, fmt.Errorf("%v: %v", resolved, err)
+	}
+
 	if !ignoreLogging {
 		// The configuration file may have enabled global logging,
 		// so handle that before any log calls.
-		err = handleGlobalLog(logfilePath)
+		err = handleLogBackend(logBackend, logfilePath, tomlConf.Runtime.logRotation())
+		if err != nil {
+			return "", "", config, err
+		}
+
+		err = handleAuditLog(tomlConf.Runtime.AuditLogPath, tomlConf.Runtime.AuditLogHashChain)
+		if err != nil {
+			return "", "", config, err
+		}
+
+		err = handlePodLog(tomlConf.Runtime.PodLogDir, podLogRetention)
+		if err != nil {
+			return "", "", config, err
+		}
+
+		err = handleTracing(tomlConf.Runtime.TraceEndpoint, tomlConf.Runtime.TraceFile)
 		if err != nil {
 			return "", "", config, err
 		}
@@ -370,6 +479,11 @@ func loadConfiguration(configPath string, ignoreLogging bool) (resolvedConfigPat
 		ccLog.Debugf("TOML configuration: %v", tomlConf)
 	}
 
+	// The storage is needed to access the pods, whatever the command.
+	if err := handleStorage(storageType); err != nil {
+		return "", "", config, err
+	}
+
 	if err := updateRuntimeConfig(resolved, tomlConf, &config); err != nil {
 		return "", "", config, err
 	}
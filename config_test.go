@@ -26,6 +26,7 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
@@ -871,3 +872,88 @@ func TestAgentDefaults(t *testing.T) {
 	a.PauseRootPath = path
 	assert.Equal(t, a.pauseRootPath(), path, "custom agent pause root path wrong")
 }
+
+func TestRuntimeDefaults(t *testing.T) {
+	r := runtime{}
+
+	backend, err := r.logBackend()
+	assert.NoError(t, err)
+	assert.Equal(t, backend, fileLogBackend, "default log backend wrong")
+
+	for _, b := range []string{fileLogBackend, syslogLogBackend, journaldLogBackend} {
+		r.LogBackend = b
+		backend, err = r.logBackend()
+		assert.NoError(t, err)
+		assert.Equal(t, backend, b, "custom log backend wrong")
+	}
+
+	r.LogBackend = "foo"
+	_, err = r.logBackend()
+	assert.Error(t, err)
+}
+
+func TestRuntimeLogRotation(t *testing.T) {
+	r := runtime{}
+
+	rotation := r.logRotation()
+	assert.Equal(t, rotation.maxSize, int64(0), "rotation should be disabled by default")
+	assert.Equal(t, rotation.maxFiles, defaultGlobalLogMaxFiles)
+	assert.False(t, rotation.compress)
+
+	maxFiles := uint32(3)
+
+	r.GlobalLogMaxSize = 4
+	r.GlobalLogMaxFiles = &maxFiles
+	r.GlobalLogCompress = true
+
+	rotation = r.logRotation()
+	assert.Equal(t, rotation.maxSize, int64(4*1024*1024))
+	assert.Equal(t, rotation.maxFiles, 3)
+	assert.True(t, rotation.compress)
+
+	maxFiles = 0
+
+	rotation = r.logRotation()
+	assert.Equal(t, rotation.maxFiles, 0, "no rotated files should be kept")
+}
+
+func TestRuntimeStorage(t *testing.T) {
+	r := runtime{}
+
+	storageType, err := r.storage()
+	assert.NoError(t, err)
+	assert.Equal(t, storageType, vc.FilesystemStorage, "default storage wrong")
+
+	r.Storage = "kv"
+	storageType, err = r.storage()
+	assert.NoError(t, err)
+	assert.Equal(t, storageType, vc.KVStorage, "custom storage wrong")
+
+	r.Storage = "foo"
+	_, err = r.storage()
+	assert.Error(t, err)
+}
+
+func TestRuntimePodLogRetention(t *testing.T) {
+	r := runtime{}
+
+	retention, err := r.podLogRetention()
+	assert.NoError(t, err)
+	assert.Equal(t, retention, defaultPodLogRetention)
+
+	r.PodLogRetention = "0"
+	retention, err = r.podLogRetention()
+	assert.NoError(t, err)
+	assert.Equal(t, retention, time.Duration(0))
+
+	r.PodLogRetention = "90m"
+	retention, err = r.podLogRetention()
+	assert.NoError(t, err)
+	assert.Equal(t, retention, 90*time.Minute)
+
+	for _, invalid := range []string{"foo", "10", "-1h"} {
+		r.PodLogRetention = invalid
+		_, err = r.podLogRetention()
+		assert.Error(t, err, "retention %q", invalid)
+	}
+}
@@ -147,3 +147,31 @@ func saneTerminal(terminal *os.File) error {
 
 	return nil
 }
+
+// winsize is the size of a terminal window (struct winsize).
+type winsize struct {
+	Height uint16
+	Width  uint16
+	x      uint16
+	y      uint16
+}
+
+// getWinsize returns the window size of the specified terminal.
+func getWinsize(terminal *os.File) (winsize, error) {
+	var ws winsize
+
+	if err := ioctl(terminal.Fd(), unix.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+		return winsize{}, fmt.Errorf("ioctl(tty, tiocgwinsz): %s", err.Error())
+	}
+
+	return ws, nil
+}
+
+// setWinsize sets the window size of the specified terminal.
+func setWinsize(terminal *os.File, ws winsize) error {
+	if err := ioctl(terminal.Fd(), unix.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+		return fmt.Errorf("ioctl(tty, tiocswinsz): %s", err.Error())
+	}
+
+	return nil
+}
@@ -60,3 +60,36 @@ func TestIsTerminal(t *testing.T) {
 		t.Fatalf("Fd %d is a terminal", fd)
 	}
 }
+
+func TestWinsize(t *testing.T) {
+	console, err := newConsole()
+	if err != nil {
+		t.Fatalf("failed to create a new console: %s", err)
+	}
+	defer console.Close()
+
+	slave, err := os.OpenFile(console.Path(), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("failed to open console slave: %s", err)
+	}
+	defer slave.Close()
+
+	expected := winsize{Height: 40, Width: 132}
+
+	if err := setWinsize(console.File(), expected); err != nil {
+		t.Fatalf("failed to set window size: %s", err)
+	}
+
+	ws, err := getWinsize(slave)
+	if err != nil {
+		t.Fatalf("failed to get window size: %s", err)
+	}
+
+	if ws.Height != expected.Height || ws.Width != expected.Width {
+		t.Fatalf("expected window size %+v, got %+v", expected, ws)
+	}
+
+	if _, err := getWinsize(os.Stdout); err == nil && !isTerminal(os.Stdout.Fd()) {
+		t.Fatalf("expected error getting window size of a non-terminal")
+	}
+}
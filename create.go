@@ -16,6 +16,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -62,6 +63,7 @@ var createCLICommand = cli.Command{
 			Value: "",
 			Usage: "specify the file to write the process id to",
 		},
+		preserveFdsFlag,
 	},
 	Action: func(context *cli.Context) error {
 		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
@@ -69,6 +71,10 @@ var createCLICommand = cli.Command{
 			return errors.New("invalid runtime config")
 		}
 
+		if err := checkPreservedFds(context.Uint("preserve-fds")); err != nil {
+			return err
+		}
+
 		console, err := setupConsole(context.String("console"), context.String("console-socket"))
 		if err != nil {
 			return err
@@ -85,8 +91,9 @@ var createCLICommand = cli.Command{
 }
 
 func create(containerID, bundlePath, console, pidFilePath string, detach bool,
-	runtimeConfig oci.RuntimeConfig) error {
-	var err error
+	runtimeConfig oci.RuntimeConfig) (err error) {
+	audit := newAuditEntry("create", containerID)
+	defer func() { audit.finish(err) }()
 
 	// Checks the MUST and MUST NOT from OCI runtime specification
 	if bundlePath, err = validCreateParams(containerID, bundlePath); err != nil {
@@ -106,14 +113,24 @@ func create(containerID, bundlePath, console, pidFilePath string, detach bool,
 	disableOutput := noNeedForOutput(detach, ociSpec.Process.Terminal)
 
 	var process vc.Process
+	var podID string
 
 	switch containerType {
 	case vc.PodSandbox:
+		podID = containerID
+		audit.PodID = podID
+
 		process, err = createPod(ociSpec, runtimeConfig, containerID, bundlePath, console, disableOutput)
 		if err != nil {
 			return err
 		}
 	case vc.PodContainer:
+		if podID, err = ociSpec.PodID(); err != nil {
+			return err
+		}
+
+		audit.PodID = podID
+
 		process, err = createContainer(ociSpec, containerID, bundlePath, console, disableOutput)
 		if err != nil {
 			return err
@@ -122,6 +139,17 @@ func create(containerID, bundlePath, console, pidFilePath string, detach bool,
 		return fmt.Errorf("Invalid container type %q found", string(containerType))
 	}
 
+	// From now on, a failure undoes the creation so that the host is
+	// left clean.
+	var createdCgroups []string
+	pidFileCreated := false
+
+	defer func() {
+		if err != nil {
+			rollbackCreate(containerType, podID, containerID, createdCgroups, pidFilePath, pidFileCreated)
+		}
+	}()
+
 	// config.json provides a cgroups path that has to be used to create "tasks"
 	// and "cgroups.procs" files. Those files have to be filled with a PID, which
 	// is shim's in our case. This is mandatory to make sure there is no one
@@ -132,13 +160,23 @@ func create(containerID, bundlePath, console, pidFilePath string, detach bool,
 		return err
 	}
 
-	if err := createCgroupsFiles(cgroupsPathList, process.Pid); err != nil {
+	if createdCgroups, err = createCgroupsFiles(cgroupsPathList, process.Pid); err != nil {
+		return err
+	}
+
+	// Recorded so that cc-gc can remove them if delete does not.
+	if err := recordCgroups(podID, containerID, createdCgroups); err != nil {
+		return err
+	}
+
+	if err := indexContainer(containerID, podID); err != nil {
 		return err
 	}
 
 	// Creation of PID file has to be the last thing done in the create
 	// because containerd considers the create complete after this file
 	// is created.
+	pidFileCreated = true
 	if err := createPIDFile(pidFilePath, process.Pid); err != nil {
 		return err
 	}
@@ -146,8 +184,56 @@ func create(containerID, bundlePath, console, pidFilePath string, detach bool,
 	return nil
 }
 
+// rollbackCreate undoes a create that failed after the pod or container
+// was created, removing the PID file (if it was created), the cgroups
+// directories created and the pod or container itself.
+//
+// Failures are logged, as the original error is the one reported.
+func rollbackCreate(containerType vc.ContainerType, podID, containerID string,
+	createdCgroups []string, pidFilePath string, pidFileCreated bool) {
+	ccLog.Warnf("Rolling back creation of container %s", containerID)
+
+	if pidFileCreated && pidFilePath != "" {
+		if err := os.Remove(pidFilePath); err != nil && !os.IsNotExist(err) {
+			ccLog.Warnf("Failed to remove PID file %s: %v", pidFilePath, err)
+		}
+	}
+
+	if len(createdCgroups) > 0 {
+		if err := removeCgroupsPath(createdCgroups); err != nil {
+			ccLog.Warnf("Failed to remove cgroups of container %s: %v", containerID, err)
+		}
+	}
+
+	if err := removeCgroupsRecord(containerID); err != nil {
+		ccLog.Warnf("Failed to remove cgroups record of container %s: %v", containerID, err)
+	}
+
+	var err error
+
+	// The pod or container may be left in any state by the failure,
+	// hence the forced deletion.
+	if containerType.IsPod() {
+		err = deletePod(podID, true)
+	} else {
+		err = deleteContainer(podID, containerID, false, true)
+	}
+
+	if err != nil {
+		ccLog.Warnf("Failed to delete container %s: %v", containerID, err)
+	}
+}
+
 func createPod(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
-	containerID, bundlePath, console string, disableOutput bool) (vc.Process, error) {
+	containerID, bundlePath, console string, disableOutput bool) (_ vc.Process, err error) {
+	span, ctx := vc.StartSpan(context.Background(), "createPod")
+	span.SetTag("pod", containerID)
+	defer func() {
+		if err != nil {
+			span.SetError(err)
+		}
+		span.Finish()
+	}()
 
 	ccKernelParams := []vc.Param{
 		{
@@ -178,12 +264,22 @@ func createPod(ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
 		}
 	}
 
+	if err := prunePodLogs(); err != nil {
+		ccLog.Warnf("Failed to prune pod logs: %v", err)
+	}
+
+	if err := podLogConfig(containerID, &runtimeConfig); err != nil {
+		return vc.Process{}, err
+	}
+
+	setupPodLog(containerID)
+
 	podConfig, err := oci.PodConfig(ociSpec, runtimeConfig, bundlePath, containerID, console, disableOutput)
 	if err != nil {
 		return vc.Process{}, err
 	}
 
-	pod, err := vc.CreatePod(podConfig)
+	pod, err := vc.CreatePodContext(ctx, podConfig)
 	if err != nil {
 		return vc.Process{}, err
 	}
@@ -209,6 +305,8 @@ func createContainer(ociSpec oci.CompatOCISpec, containerID, bundlePath,
 		return vc.Process{}, err
 	}
 
+	setupPodLog(podID)
+
 	_, c, err := vc.CreateContainer(podID, contConfig)
 	if err != nil {
 		return vc.Process{}, err
@@ -217,15 +315,32 @@ func createContainer(ociSpec oci.CompatOCISpec, containerID, bundlePath,
 	return c.Process(), nil
 }
 
-func createCgroupsFiles(cgroupsPathList []string, pid int) error {
+// createCgroupsFiles creates the cgroups files of the container process
+// and returns the cgroups directories it had to create. If it fails, it
+// removes the directories it created.
+func createCgroupsFiles(cgroupsPathList []string, pid int) (created []string, err error) {
 	if len(cgroupsPathList) == 0 {
 		ccLog.Info("Cgroups files not created because cgroupsPath was empty")
-		return nil
+		return nil, nil
 	}
 
+	defer func() {
+		if err != nil && len(created) > 0 {
+			if rmErr := removeCgroupsPath(created); rmErr != nil {
+				ccLog.Warnf("Failed to remove cgroups directories: %v", rmErr)
+			}
+
+			created = nil
+		}
+	}()
+
 	for _, cgroupsPath := range cgroupsPathList {
+		if _, err := os.Stat(cgroupsPath); os.IsNotExist(err) {
+			created = append(created, cgroupsPath)
+		}
+
 		if err := os.MkdirAll(cgroupsPath, cgroupsDirMode); err != nil {
-			return err
+			return created, err
 		}
 
 		tasksFilePath := filepath.Join(cgroupsPath, cgroupsTasksFile)
@@ -236,23 +351,23 @@ func createCgroupsFiles(cgroupsPathList []string, pid int) error {
 		for _, path := range []string{tasksFilePath, procsFilePath} {
 			f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, cgroupsFileMode)
 			if err != nil {
-				return err
+				return created, err
 			}
 			defer f.Close()
 
 			n, err := f.WriteString(pidStr)
 			if err != nil {
-				return err
+				return created, err
 			}
 
 			if n < len(pidStr) {
-				return fmt.Errorf("Could not write pid to %q: only %d bytes written out of %d",
+				return created, fmt.Errorf("Could not write pid to %q: only %d bytes written out of %d",
 					path, n, len(pidStr))
 			}
 		}
 	}
 
-	return nil
+	return created, nil
 }
 
 func createPIDFile(pidFilePath string, pid int) error {
@@ -26,7 +26,7 @@ var testPID = 100
 var testStrPID = fmt.Sprintf("%d", testPID)
 
 func testCreateCgroupsFilesSuccessful(t *testing.T, cgroupsPathList []string, pid int) {
-	if err := createCgroupsFiles(cgroupsPathList, pid); err != nil {
+	if _, err := createCgroupsFiles(cgroupsPathList, pid); err != nil {
 		t.Fatalf("This test should succeed (cgroupsPath %q, pid %d): %s", cgroupsPathList, pid, err)
 	}
 }
@@ -64,6 +64,60 @@ func TestCgroupsFilesNonEmptyCgroupsPathSuccessful(t *testing.T) {
 	}
 }
 
+func TestCgroupsFilesCreatedDirectories(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(testDir, "cgroups-path-")
+	if err != nil {
+		t.Fatalf("Could not create temporary cgroups directory: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	newPath := filepath.Join(tmpDir, "new")
+
+	created, err := createCgroupsFiles([]string{tmpDir, newPath}, testPID)
+	if err != nil {
+		t.Fatalf("This test should succeed: %s", err)
+	}
+
+	// only the directory which did not exist is reported as created
+	if len(created) != 1 || created[0] != newPath {
+		t.Fatalf("Expected created directories [%s], got %v", newPath, created)
+	}
+}
+
+func TestCgroupsFilesFailureRemovesCreatedDirectories(t *testing.T) {
+	tmpDir, err := ioutil.TempDir(testDir, "cgroups-path-")
+	if err != nil {
+		t.Fatalf("Could not create temporary cgroups directory: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	newPath := filepath.Join(tmpDir, "new")
+	badPath := filepath.Join(tmpDir, "bad")
+
+	// the tasks file cannot be created in badPath
+	if err := os.MkdirAll(filepath.Join(badPath, cgroupsTasksFile), testDirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := createCgroupsFiles([]string{newPath, badPath}, testPID)
+	if err == nil {
+		t.Fatal("This test should fail")
+	}
+
+	if len(created) != 0 {
+		t.Fatalf("Expected no created directories, got %v", created)
+	}
+
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Fatalf("Path %q should have been removed: %v", newPath, err)
+	}
+
+	// badPath existed before and must not be removed
+	if _, err := os.Stat(badPath); err != nil {
+		t.Fatalf("Path %q should not have been removed: %v", badPath, err)
+	}
+}
+
 func TestCreatePIDFileSuccessful(t *testing.T) {
 	pidDirPath, err := ioutil.TempDir(testDir, "pid-path-")
 	if err != nil {
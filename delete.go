@@ -18,12 +18,17 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
 )
 
+// maxParallelDeletes is the maximum number of pods deleted in parallel.
+var maxParallelDeletes = 8
+
 var deleteCLICommand = cli.Command{
 	Name:  "delete",
 	Usage: "Delete any resources held by one or more containers",
@@ -37,37 +42,189 @@ EXAMPLE:
    for "ubuntu01" removing "ubuntu01" from the ` + name + ` list of containers:
 
        # ` + name + ` delete ubuntu01`,
+	Description: `The delete command deletes the specified containers, or all the
+   containers if --all is set. The containers of different pods are deleted
+   in parallel. A failure to delete a container does not prevent the other
+   containers from being deleted, and all the failures are reported.`,
 	Flags: []cli.Flag{
 		cli.BoolFlag{
-			Name:  "force, f",
-			Usage: "Forcibly deletes the container if it is still running (uses SIGKILL)",
+			Name: "force, f",
+			Usage: "Forcibly deletes the container if it is still running (uses SIGKILL), " +
+				"killing the hypervisor and shims and removing the state if it can not be stopped or its state can not be read",
+		},
+		cli.BoolFlag{
+			Name:  "all, a",
+			Usage: "Delete all the containers",
 		},
 	},
 	Action: func(context *cli.Context) error {
 		args := context.Args()
-		if args.Present() == false {
-			return fmt.Errorf("Missing container ID, should at least provide one")
+		all := context.Bool("all")
+
+		if all && args.Present() {
+			return fmt.Errorf("Container IDs can not be specified along with --all")
 		}
 
-		force := context.Bool("force")
-		for _, cID := range []string(args) {
-			if err := delete(cID, force); err != nil {
+		containerIDs := []string(args)
+
+		if all {
+			var err error
+			if containerIDs, err = allContainerIDs(); err != nil {
 				return err
 			}
+		} else if args.Present() == false {
+			return fmt.Errorf("Missing container ID, should at least provide one")
 		}
 
-		return nil
+		return deleteContainers(containerIDs, context.Bool("force"))
 	},
 }
 
-func delete(containerID string, force bool) error {
+// allContainerIDs returns the IDs of all the containers, those of the
+// pod sandboxes coming after the containers of their pod.
+func allContainerIDs() ([]string, error) {
+	pods, err := vc.ListPod()
+	if err != nil {
+		return nil, err
+	}
+
+	var containerIDs []string
+
+	for _, pod := range pods {
+		for _, container := range pod.ContainersStatus {
+			if container.ID != pod.ID {
+				containerIDs = append(containerIDs, container.ID)
+			}
+		}
+
+		for _, container := range pod.ContainersStatus {
+			if container.ID == pod.ID {
+				containerIDs = append(containerIDs, container.ID)
+			}
+		}
+	}
+
+	return containerIDs, nil
+}
+
+// deleteBatches groups the containers to delete by pod, keeping their
+// order but deleting the sandbox of a pod, which deletes the whole pod,
+// after its other containers. A container which can not be found is
+// put in its own batch, its deletion failing.
+func deleteBatches(containerIDs []string) [][]string {
+	var batches [][]string
+	podBatch := make(map[string]int)
+	sandboxes := make(map[string]string)
+
+	for _, containerID := range containerIDs {
+		entry, err := lookupContainer(containerID, false)
+		if err != nil || entry.ID == "" {
+			batches = append(batches, []string{containerID})
+			continue
+		}
+
+		if entry.ID == entry.PodID {
+			sandboxes[entry.PodID] = containerID
+		}
+
+		idx, ok := podBatch[entry.PodID]
+		if !ok {
+			idx = len(batches)
+			podBatch[entry.PodID] = idx
+			batches = append(batches, nil)
+		}
+
+		if entry.ID != entry.PodID {
+			batches[idx] = append(batches[idx], containerID)
+		}
+	}
+
+	for podID, containerID := range sandboxes {
+		idx := podBatch[podID]
+		batches[idx] = append(batches[idx], containerID)
+	}
+
+	return batches
+}
+
+// deleteContainers deletes the specified containers, deleting up to
+// maxParallelDeletes pods in parallel. All the containers are deleted
+// even if some fail to be, the errors being aggregated.
+func deleteContainers(containerIDs []string, force bool) error {
+	batches := deleteBatches(containerIDs)
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	failures := make(map[string]error)
+
+	sem := make(chan struct{}, maxParallelDeletes)
+
+	for _, batch := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(batch []string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			// The containers of a pod are deleted one after the
+			// other, as the pod is locked while any of them is.
+			for _, containerID := range batch {
+				if err := delete(containerID, force); err != nil {
+					mutex.Lock()
+					failures[containerID] = err
+					mutex.Unlock()
+				}
+			}
+		}(batch)
+	}
+
+	wg.Wait()
+
+	return deleteError(containerIDs, failures)
+}
+
+// deleteError returns an error aggregating the failures to delete the
+// containers, in the order the containers were specified, or nil.
+func deleteError(containerIDs []string, failures map[string]error) error {
+	if len(failures) == 0 {
+		return nil
+	}
+
+	if len(containerIDs) == 1 {
+		return failures[containerIDs[0]]
+	}
+
+	var msgs []string
+	for _, containerID := range containerIDs {
+		if err, ok := failures[containerID]; ok {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", containerID, err))
+		}
+	}
+
+	return fmt.Errorf("Failed to delete %d of %d containers:\n%s",
+		len(failures), len(containerIDs), strings.Join(msgs, "\n"))
+}
+
+func delete(containerID string, force bool) (err error) {
+	audit := newAuditEntry("delete", containerID)
+	defer func() { audit.finish(err) }()
+
 	// Checks the MUST and MUST NOT from OCI runtime specification
 	status, podID, err := getExistingContainerInfo(containerID)
 	if err != nil {
-		return err
+		if !force {
+			return err
+		}
+
+		return purgeUnreadable(containerID, audit, err)
 	}
 
 	containerID = status.ID
+	audit.ContainerID = containerID
+	audit.PodID = podID
 
 	containerType, err := oci.GetContainerType(status.Annotations)
 	if err != nil {
@@ -91,11 +248,11 @@ func delete(containerID string, force bool) error {
 
 	switch containerType {
 	case vc.PodSandbox:
-		if err := deletePod(podID); err != nil {
+		if err := deletePod(podID, force); err != nil {
 			return err
 		}
 	case vc.PodContainer:
-		if err := deleteContainer(podID, containerID, forceStop); err != nil {
+		if err := deleteContainer(podID, containerID, forceStop, force); err != nil {
 			return err
 		}
 	default:
@@ -110,30 +267,101 @@ func delete(containerID string, force bool) error {
 		return err
 	}
 
-	return removeCgroupsPath(cgroupsPathList)
+	if err := removeCgroupsPath(cgroupsPathList); err != nil {
+		return err
+	}
+
+	return removeCgroupsRecord(containerID)
 }
 
-func deletePod(podID string) error {
-	if _, err := vc.StopPod(podID); err != nil {
-		return err
+// deletePod stops and deletes a pod. If force is true and the pod can
+// not be stopped or deleted, it is purged.
+func deletePod(podID string, force bool) error {
+	_, err := vc.StopPod(podID)
+	if err == nil {
+		_, err = vc.DeletePod(podID)
 	}
 
-	if _, err := vc.DeletePod(podID); err != nil {
-		return err
+	if err != nil {
+		if !force {
+			return err
+		}
+
+		ccLog.Warnf("Failed to delete pod %v, purging it: %v", podID, err)
+
+		if _, err := vc.PurgePod(podID); err != nil {
+			return err
+		}
+	}
+
+	if err := unindexPod(podID); err != nil {
+		ccLog.Warnf("Failed to remove pod %v from container index: %v", podID, err)
+	}
+
+	if err := markPodLogDeleted(podID); err != nil {
+		ccLog.Warnf("Failed to mark logs of pod %v as deleted: %v", podID, err)
+	}
+
+	if err := prunePodLogs(); err != nil {
+		ccLog.Warnf("Failed to prune pod logs: %v", err)
 	}
 
 	return nil
 }
 
-func deleteContainer(podID, containerID string, forceStop bool) error {
+// purgeUnreadable deletes a container whose status can not be read,
+// e.g. because the state of its pod is corrupted, using the pod recorded
+// for it in the container index. The container, or its whole pod if it
+// is the sandbox, ends up being purged as it can not be stopped or
+// deleted. statusErr is returned if the container is not indexed.
+//
+// The cgroups of the container are left to cc-gc.
+func purgeUnreadable(containerID string, audit *auditEntry, statusErr error) error {
+	entry, err := lookupContainer(containerID, false)
+	if err != nil || entry.ID == "" {
+		return statusErr
+	}
+
+	audit.ContainerID = entry.ID
+	audit.PodID = entry.PodID
+
+	ccLog.Warnf("Failed to get status of container %v: %v", entry.ID, statusErr)
+
+	if entry.ID == entry.PodID {
+		return deletePod(entry.PodID, true)
+	}
+
+	return deleteContainer(entry.PodID, entry.ID, true, true)
+}
+
+// deleteContainer deletes a container, stopping it first if forceStop
+// is true. If force is true and the container can not be stopped or
+// deleted, it is purged.
+func deleteContainer(podID, containerID string, forceStop, force bool) error {
+	var err error
+
 	if forceStop {
-		if _, err := vc.StopContainer(podID, containerID); err != nil {
+		_, err = vc.StopContainer(podID, containerID)
+	}
+
+	if err == nil {
+		_, err = vc.DeleteContainer(podID, containerID)
+	}
+
+	if err != nil {
+		if !force {
+			return err
+		}
+
+		ccLog.Warnf("Failed to delete container %v, purging it: %v", containerID, err)
+
+		if _, err := vc.PurgeContainer(podID, containerID); err != nil {
 			return err
 		}
 	}
 
-	if _, err := vc.DeleteContainer(podID, containerID); err != nil {
-		return err
+	if err := unindexContainer(containerID); err != nil {
+		ccLog.Warnf("Failed to remove container %v from container index: %v", containerID, err)
 	}
 
 	return nil
@@ -15,9 +15,14 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"io/ioutil"
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
 )
 
 func testRemoveCgroupsPathSuccessful(t *testing.T, cgroupsPathList []string) {
@@ -46,3 +51,93 @@ func TestRemoveCgroupsPathNonEmptyPathSuccessful(t *testing.T) {
 		t.Fatalf("CgroupsPath directory %q should have been removed: %s", cgroupsPath, err)
 	}
 }
+
+func TestDeleteCLIFunctionArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	fn, ok := deleteCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	// no container ID
+	set := flag.NewFlagSet("", 0)
+	ctx := cli.NewContext(cli.NewApp(), set, nil)
+	assert.Error(fn(ctx))
+
+	// container IDs and --all
+	set = flag.NewFlagSet("", 0)
+	set.Bool("all", true, "")
+	assert.NoError(set.Parse([]string{"foo"}))
+	ctx = cli.NewContext(cli.NewApp(), set, nil)
+	assert.Error(fn(ctx))
+}
+
+func TestDeleteBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setTestContainerIndexDir(t)()
+
+	assert.NoError(indexContainer("pod1", "pod1"))
+	assert.NoError(indexContainer("c1", "pod1"))
+	assert.NoError(indexContainer("c2", "pod1"))
+	assert.NoError(indexContainer("pod2", "pod2"))
+	assert.NoError(indexContainer("c3", "pod2"))
+
+	// The sandbox of a pod comes after its containers, and unknown
+	// containers get their own batch.
+	batches := deleteBatches([]string{"pod1", "c3", "unknown", "c1", "pod2"})
+	assert.Equal([][]string{
+		{"c1", "pod1"},
+		{"c3", "pod2"},
+		{"unknown"},
+	}, batches)
+}
+
+func TestDeleteContainersContinueOnError(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setTestContainerIndexDir(t)()
+
+	err := deleteContainers([]string{"unknown1", "unknown2"}, false)
+	assert.Error(err)
+	assert.Contains(err.Error(), "unknown1")
+	assert.Contains(err.Error(), "unknown2")
+}
+
+func TestDeleteError(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(deleteError([]string{"foo"}, map[string]error{}))
+
+	fooErr := errors.New("foo error")
+
+	// A single container gets its own error.
+	assert.Equal(fooErr, deleteError([]string{"foo"}, map[string]error{"foo": fooErr}))
+
+	err := deleteError([]string{"foo", "bar", "baz"}, map[string]error{
+		"baz": errors.New("baz error"),
+		"foo": fooErr,
+	})
+	assert.Error(err)
+	assert.Equal("Failed to delete 2 of 3 containers:\nfoo: foo error\nbaz: baz error", err.Error())
+}
+
+func TestPurgeUnreadable(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setTestContainerIndexDir(t)()
+
+	statusErr := errors.New("status error")
+
+	// A container which is not indexed can not be purged.
+	audit := newAuditEntry("delete", "unknown")
+	assert.Equal(statusErr, purgeUnreadable("unknown", audit, statusErr))
+
+	// The pod of an indexed container is recorded, even if the purge
+	// fails.
+	assert.NoError(indexContainer("c1", "pod1"))
+
+	audit = newAuditEntry("delete", "c1")
+	assert.Error(purgeUnreadable("c1", audit, statusErr))
+	assert.Equal("c1", audit.ContainerID)
+	assert.Equal("pod1", audit.PodID)
+}
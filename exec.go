@@ -19,8 +19,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
-	"syscall"
+	"regexp"
+	"strconv"
+	"strings"
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
@@ -28,6 +29,8 @@ import (
 	"github.com/urfave/cli"
 )
 
+var capabilityNameRegex = regexp.MustCompile(`^CAP_[A-Z_]+$`)
+
 type execParams struct {
 	ociProcess   oci.CompatOCIProcess
 	cID          string
@@ -37,6 +40,12 @@ type execParams struct {
 	detach       bool
 	processLabel string
 	noSubreaper  bool
+
+	// caps are the capabilities added with --cap.
+	caps []string
+
+	// noNewPrivs is set with --no-new-privs.
+	noNewPrivs bool
 }
 
 var execCLICommand = cli.Command{
@@ -109,6 +118,7 @@ EXAMPLE:
 			Value: &cli.StringSlice{},
 			Usage: "add a capability to the bounding set for the process",
 		},
+		preserveFdsFlag,
 		cli.BoolFlag{
 			Name:   "no-subreaper",
 			Usage:  "disable the use of the subreaper used to reap reparented processes",
@@ -156,9 +166,14 @@ func generateExecParams(context *cli.Context, specProcess *oci.CompatOCIProcess)
 
 		// Override user
 		if context.String("user") != "" {
-			params.ociProcess.User = specs.User{
-				Username: context.String("user"),
+			uid, gid, err := parseExecUser(context.String("user"))
+			if err != nil {
+				return execParams{}, err
 			}
+
+			params.ociProcess.User.UID = uid
+			params.ociProcess.User.GID = gid
+			params.ociProcess.User.Username = ""
 		}
 
 		// Override env
@@ -171,7 +186,8 @@ func generateExecParams(context *cli.Context, specProcess *oci.CompatOCIProcess)
 
 		// Override no-new-privs
 		if context.IsSet("no-new-privs") {
-			params.ociProcess.NoNewPrivileges = context.Bool("no-new-privs")
+			params.noNewPrivs = context.Bool("no-new-privs")
+			params.ociProcess.NoNewPrivileges = params.noNewPrivs
 		}
 
 		// Override apparmor
@@ -182,16 +198,124 @@ func generateExecParams(context *cli.Context, specProcess *oci.CompatOCIProcess)
 		params.ociProcess.Args = ctxArgs.Tail()
 	}
 
+	if err := checkPreservedFds(context.Uint("preserve-fds")); err != nil {
+		return execParams{}, err
+	}
+
+	caps, err := execCapabilities(context.StringSlice("cap"))
+	if err != nil {
+		return execParams{}, err
+	}
+
+	params.caps = caps
+
+	// The no new privileges setting and the capabilities of the process
+	// file, or of the container, apply to the container processes as a
+	// whole, which the agent may not be able to restrict for a single
+	// process: only those explicitly requested for the process are
+	// applied, as for create.
+	if params.ociProcess.NoNewPrivileges && !params.noNewPrivs {
+		ccLog.Warnf("Ignoring no new privileges for process %v, use --no-new-privs to set it", params.ociProcess.Args)
+	}
+
+	if params.ociProcess.Capabilities != nil {
+		ccLog.Warnf("Ignoring capabilities for process %v, use --cap to add capabilities", params.ociProcess.Args)
+	}
+
 	return params, nil
 }
 
-func execute(context *cli.Context) error {
+// parseExecUser parses a user specified as "<uid>[:<gid>]".
+func parseExecUser(user string) (uid, gid uint32, err error) {
+	fields := strings.SplitN(user, ":", 2)
+
+	id, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid user %q: format is <uid>[:<gid>]", user)
+	}
+
+	uid = uint32(id)
+
+	if len(fields) == 2 {
+		id, err = strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Invalid user %q: format is <uid>[:<gid>]", user)
+		}
+
+		gid = uint32(id)
+	}
+
+	return uid, gid, nil
+}
+
+// execCapabilities returns the capabilities specified with --cap in
+// the canonical "CAP_<name>" form.
+func execCapabilities(caps []string) ([]string, error) {
+	var result []string
+
+	for _, c := range caps {
+		name := strings.ToUpper(c)
+		if !strings.HasPrefix(name, "CAP_") {
+			name = "CAP_" + name
+		}
+
+		if !capabilityNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("Invalid capability %q", c)
+		}
+
+		result = append(result, name)
+	}
+
+	return result, nil
+}
+
+// execUser returns the user and groups of the process to execute as
+// expected by virtcontainers. A user name (which can only be specified
+// in a process file) is passed as is.
+func execUser(user specs.User) (string, string, []string) {
+	name := user.Username
+	if name == "" {
+		name = strconv.FormatUint(uint64(user.UID), 10)
+	}
+
+	groups := []string{}
+	for _, gid := range user.AdditionalGids {
+		groups = append(groups, strconv.FormatUint(uint64(gid), 10))
+	}
+
+	return name, strconv.FormatUint(uint64(user.GID), 10), groups
+}
+
+// execRlimits converts the OCI resource limits of the process to
+// execute into virtcontainers resource limits.
+func execRlimits(rlimits []specs.LinuxRlimit) []vc.Rlimit {
+	var result []vc.Rlimit
+
+	for _, r := range rlimits {
+		result = append(result, vc.Rlimit{
+			Type: r.Type,
+			Hard: r.Hard,
+			Soft: r.Soft,
+		})
+	}
+
+	return result
+}
+
+func execute(context *cli.Context) (err error) {
 	containerID := context.Args().First()
+
+	audit := newAuditEntry("exec", containerID)
+	defer func() { audit.finish(err) }()
+
 	status, podID, err := getExistingContainerInfo(containerID)
 	if err != nil {
 		return err
 	}
 
+	audit.ContainerID = status.ID
+	audit.PodID = podID
+
 	// Retrieve OCI spec configuration.
 	ociSpec, err := oci.GetOCIConfig(status)
 	if err != nil {
@@ -204,6 +328,7 @@ func execute(context *cli.Context) error {
 	}
 
 	params.cID = status.ID
+	audit.Args = params.ociProcess.Args
 
 	// container MUST be running
 	if status.State.State != vc.StateRunning {
@@ -220,14 +345,32 @@ func execute(context *cli.Context) error {
 		return err
 	}
 
+	// The process label is applied by the host, not by the guest.
+	if params.processLabel != "" {
+		return fmt.Errorf("Process label %q cannot be applied to a process in a virtual machine", params.processLabel)
+	}
+
+	user, group, supplementaryGroups := execUser(params.ociProcess.User)
+
 	cmd := vc.Cmd{
-		Args:        params.ociProcess.Args,
-		Envs:        envVars,
-		WorkDir:     params.ociProcess.Cwd,
-		User:        params.ociProcess.User.Username,
-		Interactive: params.ociProcess.Terminal,
-		Console:     consolePath,
-		Detach:      noNeedForOutput(params.detach, params.ociProcess.Terminal),
+		Args:                params.ociProcess.Args,
+		Envs:                envVars,
+		WorkDir:             params.ociProcess.Cwd,
+		User:                user,
+		PrimaryGroup:        group,
+		SupplementaryGroups: supplementaryGroups,
+		Capabilities:        params.caps,
+		NoNewPrivileges:     params.noNewPrivs,
+		Rlimits:             execRlimits(params.ociProcess.Rlimits),
+		Interactive:         params.ociProcess.Terminal,
+		Console:             consolePath,
+		Detach:              noNeedForOutput(params.detach, params.ociProcess.Terminal),
+	}
+
+	if !params.detach && !params.noSubreaper {
+		if err := setSubreaper(); err != nil {
+			return err
+		}
 	}
 
 	_, _, process, err := vc.EnterContainer(podID, params.cID, cmd)
@@ -243,19 +386,23 @@ func execute(context *cli.Context) error {
 	}
 
 	if !params.detach {
-		p, err := os.FindProcess(process.Pid)
-		if err != nil {
-			return err
+		if params.ociProcess.Terminal {
+			stop := forwardWinsize(podID, params.cID, process.Token, consolePath)
+			defer stop()
 		}
 
-		ps, err := p.Wait()
+		stopSignals := forwardSignals(shimSignaller(process.Pid))
+
+		exitCode, err := waitShim(process.Pid)
+		stopSignals()
+		reapChildren()
+
 		if err != nil {
-			return fmt.Errorf("Process state %s, container info %+v: %v",
-				ps.String(), status, err)
+			return fmt.Errorf("Failed to wait for process in container %s: %v", params.cID, err)
 		}
 
 		// Exit code has to be forwarded in this case.
-		return cli.NewExitError("", ps.Sys().(syscall.WaitStatus).ExitStatus())
+		return cli.NewExitError("", exitCode)
 	}
 
 	return nil
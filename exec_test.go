@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestParseExecUser(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		user  string
+		uid   uint32
+		gid   uint32
+		valid bool
+	}
+
+	data := []testData{
+		{"0", 0, 0, true},
+		{"1000", 1000, 0, true},
+		{"1000:100", 1000, 100, true},
+		{"", 0, 0, false},
+		{"root", 0, 0, false},
+		{"1000:", 0, 0, false},
+		{"1000:users", 0, 0, false},
+		{"-1", 0, 0, false},
+		{"4294967296", 0, 0, false},
+	}
+
+	for _, d := range data {
+		uid, gid, err := parseExecUser(d.user)
+		if !d.valid {
+			assert.Error(err, "user %q", d.user)
+			continue
+		}
+
+		assert.NoError(err, "user %q", d.user)
+		assert.Equal(d.uid, uid, "user %q", d.user)
+		assert.Equal(d.gid, gid, "user %q", d.user)
+	}
+}
+
+func TestExecCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	caps, err := execCapabilities(nil)
+	assert.NoError(err)
+	assert.Empty(caps)
+
+	caps, err = execCapabilities([]string{"CAP_NET_ADMIN", "sys_ptrace", "cap_kill"})
+	assert.NoError(err)
+	assert.Equal([]string{"CAP_NET_ADMIN", "CAP_SYS_PTRACE", "CAP_KILL"}, caps)
+
+	for _, c := range []string{"", "CAP_", "NET ADMIN", "CAP_1"} {
+		_, err = execCapabilities([]string{c})
+		assert.Error(err, "capability %q", c)
+	}
+}
+
+func TestExecUser(t *testing.T) {
+	assert := assert.New(t)
+
+	user, group, groups := execUser(specs.User{UID: 1000, GID: 100, AdditionalGids: []uint32{10, 29}})
+	assert.Equal("1000", user)
+	assert.Equal("100", group)
+	assert.Equal([]string{"10", "29"}, groups)
+
+	user, group, groups = execUser(specs.User{Username: "daemon"})
+	assert.Equal("daemon", user)
+	assert.Equal("0", group)
+	assert.Empty(groups)
+}
+
+func TestExecRlimits(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(execRlimits(nil))
+
+	rlimits := execRlimits([]specs.LinuxRlimit{
+		{Type: "RLIMIT_NOFILE", Hard: 1024, Soft: 512},
+	})
+
+	assert.Equal([]vc.Rlimit{{Type: "RLIMIT_NOFILE", Hard: 1024, Soft: 512}}, rlimits)
+}
+
+func TestGenerateExecParamsUser(t *testing.T) {
+	assert := assert.New(t)
+
+	set := flag.NewFlagSet("", 0)
+	set.String("user", "", "")
+	set.Var(&cli.StringSlice{}, "cap", "")
+
+	specProcess := &oci.CompatOCIProcess{}
+	specProcess.User = specs.User{UID: 0, GID: 0, AdditionalGids: []uint32{10}}
+
+	err := set.Parse([]string{"--user", "1000:100", "--cap", "net_admin", "foo", "ps"})
+	assert.NoError(err)
+
+	ctx := cli.NewContext(cli.NewApp(), set, nil)
+
+	params, err := generateExecParams(ctx, specProcess)
+	assert.NoError(err)
+	assert.Equal("foo", params.cID)
+	assert.Equal([]string{"ps"}, params.ociProcess.Args)
+	assert.Equal(specs.User{UID: 1000, GID: 100, AdditionalGids: []uint32{10}}, params.ociProcess.User)
+	assert.Equal([]string{"CAP_NET_ADMIN"}, params.caps)
+
+	set = flag.NewFlagSet("", 0)
+	set.String("user", "", "")
+	set.Var(&cli.StringSlice{}, "cap", "")
+
+	err = set.Parse([]string{"--user", "nobody", "foo", "ps"})
+	assert.NoError(err)
+
+	ctx = cli.NewContext(cli.NewApp(), set, nil)
+
+	_, err = generateExecParams(ctx, specProcess)
+	assert.Error(err)
+}
+
+func TestGenerateExecParamsPrivileges(t *testing.T) {
+	assert := assert.New(t)
+
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("", 0)
+		set.Bool("no-new-privs", false, "")
+		set.Var(&cli.StringSlice{}, "cap", "")
+
+		assert.NoError(set.Parse(args))
+
+		return cli.NewContext(cli.NewApp(), set, nil)
+	}
+
+	// inherited from the spec: ignored
+	specProcess := &oci.CompatOCIProcess{}
+	specProcess.NoNewPrivileges = true
+	specProcess.Capabilities = []string{"CAP_KILL"}
+
+	params, err := generateExecParams(newContext("foo", "ps"), specProcess)
+	assert.NoError(err)
+	assert.False(params.noNewPrivs)
+	assert.Empty(params.caps)
+
+	// explicitly requested
+	params, err = generateExecParams(newContext("--no-new-privs", "--cap", "kill", "foo", "ps"), specProcess)
+	assert.NoError(err)
+	assert.True(params.noNewPrivs)
+	assert.Equal([]string{"CAP_KILL"}, params.caps)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	// listenFdsEnv and listenPidEnv are the environment variables used
+	// by socket activation (see sd_listen_fds(3)) to pass listening
+	// sockets to a process.
+	listenFdsEnv = "LISTEN_FDS"
+	listenPidEnv = "LISTEN_PID"
+)
+
+// preserveFdsFlag is the runc-compatible flag used to pass additional
+// file descriptors to the container process.
+var preserveFdsFlag = cli.UintFlag{
+	Name:  "preserve-fds",
+	Usage: "pass N additional file descriptors to the container (rejected: file descriptors cannot be passed into the VM)",
+}
+
+// listenFds returns the number of file descriptors passed to the
+// runtime using socket activation. Following sd_listen_fds(3), they are
+// only considered to be passed to the runtime if LISTEN_PID is the PID
+// of the runtime.
+func listenFds() int {
+	pid, err := strconv.Atoi(os.Getenv(listenPidEnv))
+	if err != nil || pid != os.Getpid() {
+		return 0
+	}
+
+	fds, err := strconv.Atoi(os.Getenv(listenFdsEnv))
+	if err != nil || fds < 0 {
+		return 0
+	}
+
+	return fds
+}
+
+// checkPreservedFds returns an error if file descriptors other than
+// stdio are to be passed to the container process, either with
+// --preserve-fds or using the LISTEN_FDS convention. The flag is only
+// accepted for compatibility with runc so that such a request fails
+// explicitly.
+//
+// File descriptors cannot be passed into the VM: there is no channel
+// through the proxy and hyperstart to relay them.
+func checkPreservedFds(preserveFds uint) error {
+	if preserveFds > 0 {
+		return fmt.Errorf("Cannot preserve %d file descriptors: file descriptors cannot be passed to a container process in a virtual machine", preserveFds)
+	}
+
+	if fds := listenFds(); fds > 0 {
+		return fmt.Errorf("Cannot pass %d socket activation file descriptors (%s): file descriptors cannot be passed to a container process in a virtual machine", fds, listenFdsEnv)
+	}
+
+	return nil
+}
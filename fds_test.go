@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setTestListenEnv sets the socket activation environment variables
+// and returns a function to restore them.
+func setTestListenEnv(pid, fds string) func() {
+	savedPid := os.Getenv(listenPidEnv)
+	savedFds := os.Getenv(listenFdsEnv)
+
+	os.Setenv(listenPidEnv, pid)
+	os.Setenv(listenFdsEnv, fds)
+
+	return func() {
+		os.Setenv(listenPidEnv, savedPid)
+		os.Setenv(listenFdsEnv, savedFds)
+	}
+}
+
+func TestListenFds(t *testing.T) {
+	assert := assert.New(t)
+
+	pid := strconv.Itoa(os.Getpid())
+
+	type testData struct {
+		pid      string
+		fds      string
+		expected int
+	}
+
+	data := []testData{
+		{"", "", 0},
+		{pid, "", 0},
+		{pid, "foo", 0},
+		{pid, "-1", 0},
+		{"", "2", 0},
+		{"1", "2", 0},
+		{pid, "2", 2},
+	}
+
+	for _, d := range data {
+		restore := setTestListenEnv(d.pid, d.fds)
+		assert.Equal(d.expected, listenFds(), "pid %q fds %q", d.pid, d.fds)
+		restore()
+	}
+}
+
+func TestCheckPreservedFds(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setTestListenEnv("", "")()
+
+	assert.NoError(checkPreservedFds(0))
+	assert.Error(checkPreservedFds(1))
+
+	setTestListenEnv(strconv.Itoa(os.Getpid()), "1")
+	assert.Error(checkPreservedFds(0))
+
+	// socket activation file descriptors for another process
+	setTestListenEnv("1", "1")
+	assert.NoError(checkPreservedFds(0))
+}
@@ -0,0 +1,717 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// cgroupsRecordDirName is the directory, under the runtime root
+	// directory, recording the cgroups directories created for each
+	// container so that they can be reclaimed if delete does not
+	// remove them.
+	cgroupsRecordDirName = "cgroups"
+
+	// hypervisorNamePrefix is the prefix of the name given to the
+	// hypervisor of a pod, followed by the pod ID.
+	hypervisorNamePrefix = "pod-"
+
+	// hypervisorExitTimeout is how long to wait for a leaked hypervisor
+	// to exit once killed.
+	hypervisorExitTimeout = 5 * time.Second
+)
+
+// variables to allow tests to modify the values
+var (
+	procDir       = "/proc"
+	netnsDir      = "/var/run/netns"
+	mountInfoFile = "/proc/self/mountinfo"
+
+	cgroupsRecordDir = filepath.Join(defaultRootDirectory, cgroupsRecordDirName)
+)
+
+// tapNameRegex matches the names of the TAP interfaces created by
+// virtcontainers to connect a VM to the pod network.
+var tapNameRegex = regexp.MustCompile(`^tap[0-9]+$`)
+
+// leakedResource is a host resource which is no longer used by a pod.
+type leakedResource struct {
+	// kind is the kind of resource ("hypervisor", "mount", "netns" or
+	// "cgroups").
+	kind string
+
+	// description identifies the resource and explains why it is
+	// considered leaked.
+	description string
+
+	// reclaim frees the resource. It is nil if the resource cannot be
+	// reclaimed safely, in which case it is only reported.
+	reclaim func() error
+}
+
+// cgroupsRecord records the cgroups directories created for a container.
+type cgroupsRecord struct {
+	PodID string   `json:"podID"`
+	Paths []string `json:"paths"`
+}
+
+var gcCLICommand = cli.Command{
+	Name:  "cc-gc",
+	Usage: "reclaim the resources leaked by pods",
+	Description: `Host resources can be leaked by pods if the host crashes or the runtime
+   is killed: hypervisor processes of stopped or deleted pods, network
+   namespaces (and the TAP interfaces in them), bind mounts in the shared
+   directory and cgroups directories. This command reports and reclaims
+   them, checking them against the state of the pods.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only report the leaked resources",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+		if !ok {
+			return errors.New("invalid runtime config")
+		}
+
+		return gc(runtimeConfig.HypervisorConfig.HypervisorPath, context.Bool("dry-run"), os.Stdout)
+	},
+}
+
+// gc reports the resources leaked by pods to out and, unless dryRun is
+// true, reclaims them. hypervisorPath is the hypervisor used to run the
+// pods.
+func gc(hypervisorPath string, dryRun bool, out io.Writer) error {
+	pods, err := vc.ListPod()
+	if err != nil {
+		return err
+	}
+
+	v := newPodsView(pods)
+
+	var leaked []leakedResource
+
+	// The hypervisors must be found first, as the network namespaces
+	// they use are not considered to be in use.
+	finders := []func(*podsView) ([]leakedResource, error){
+		func(v *podsView) ([]leakedResource, error) {
+			return findLeakedHypervisors(v, hypervisorPath)
+		},
+		findLeakedMounts,
+		findLeakedNetns,
+		findLeakedCgroups,
+	}
+
+	for _, find := range finders {
+		resources, err := find(v)
+		if err != nil {
+			return err
+		}
+
+		leaked = append(leaked, resources...)
+	}
+
+	if len(leaked) == 0 {
+		fmt.Fprintln(out, "No leaked resources found")
+		return nil
+	}
+
+	failed := 0
+
+	for _, r := range leaked {
+		if r.reclaim == nil {
+			fmt.Fprintf(out, "Not reclaiming %s: %s\n", r.kind, r.description)
+			continue
+		}
+
+		if dryRun {
+			fmt.Fprintf(out, "Would reclaim %s: %s\n", r.kind, r.description)
+			continue
+		}
+
+		if err := r.reclaim(); err != nil {
+			fmt.Fprintf(out, "Failed to reclaim %s: %s: %v\n", r.kind, r.description, err)
+			failed++
+			continue
+		}
+
+		fmt.Fprintf(out, "Reclaimed %s: %s\n", r.kind, r.description)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Failed to reclaim %d of %d leaked resources", failed, len(leaked))
+	}
+
+	return nil
+}
+
+// podsView is the state of the pods the host resources are checked
+// against, built from a single scan of the pods.
+type podsView struct {
+	pods       map[string]vc.PodStatus
+	containers map[string]vc.ContainerStatus
+	netns      map[string]bool
+
+	// hypervisors are the PIDs of the leaked hypervisors.
+	hypervisors map[int]bool
+}
+
+func newPodsView(pods []vc.PodStatus) *podsView {
+	v := &podsView{
+		pods:        make(map[string]vc.PodStatus),
+		containers:  make(map[string]vc.ContainerStatus),
+		netns:       make(map[string]bool),
+		hypervisors: make(map[int]bool),
+	}
+
+	for _, pod := range pods {
+		v.pods[pod.ID] = pod
+
+		for _, c := range pod.ContainersStatus {
+			v.containers[c.ID] = c
+		}
+
+		if pod.NetworkNS.NetNsPath != "" {
+			v.netns[pod.NetworkNS.NetNsPath] = true
+		}
+	}
+
+	return v
+}
+
+// podKnown returns true if the pod exists, even if its state cannot be
+// read, for example because it is being created or deleted.
+func (v *podsView) podKnown(podID string) bool {
+	if _, ok := v.pods[podID]; ok {
+		return true
+	}
+
+	_, err := os.Lstat(vc.PodStatePath(podID))
+	return err == nil
+}
+
+// podStopped returns true if the state of the pod says it is stopped.
+func (v *podsView) podStopped(podID string) bool {
+	pod, ok := v.pods[podID]
+	return ok && pod.State.State == vc.StateStopped
+}
+
+// leakReason returns why the resources of the specified pod are
+// leaked, or "" if they are not.
+func (v *podsView) leakReason(podID string) string {
+	if !v.podKnown(podID) {
+		return "pod does not exist"
+	}
+
+	if v.podStopped(podID) {
+		return "pod is stopped"
+	}
+
+	return ""
+}
+
+// hypervisorPodID returns the ID of the pod run by the hypervisor with
+// the specified command line, or "" if it does not run a pod.
+func hypervisorPodID(args []string) string {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "-name" && strings.HasPrefix(args[i+1], hypervisorNamePrefix) {
+			return strings.TrimPrefix(args[i+1], hypervisorNamePrefix)
+		}
+	}
+
+	return ""
+}
+
+// findLeakedHypervisors returns the hypervisor processes running the VM
+// of a pod which is stopped or does not exist.
+//
+// The VM of a stopped pod is only stopped when the pod is deleted, which
+// requires the VM to be running, so these hypervisors are only reported.
+func findLeakedHypervisors(v *podsView, hypervisorPath string) ([]leakedResource, error) {
+	hypervisorPath, err := filepath.EvalSymlinks(hypervisorPath)
+	if err != nil {
+		ccLog.Warnf("Not checking hypervisor processes: %v", err)
+		return nil, nil
+	}
+
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var leaked []leakedResource
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		// the process may have exited since the directory was read
+		exe, err := os.Readlink(filepath.Join(procDir, entry.Name(), "exe"))
+		if err != nil || exe != hypervisorPath {
+			continue
+		}
+
+		cmdline, err := ioutil.ReadFile(filepath.Join(procDir, entry.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+
+		podID := hypervisorPodID(strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00"))
+		if podID == "" {
+			continue
+		}
+
+		if v.podStopped(podID) {
+			leaked = append(leaked, leakedResource{
+				kind:        "hypervisor",
+				description: fmt.Sprintf("process %d of pod %s (pod is stopped, delete the pod to stop its VM)", pid, podID),
+			})
+			continue
+		}
+
+		if v.podKnown(podID) {
+			continue
+		}
+
+		v.hypervisors[pid] = true
+
+		leaked = append(leaked, leakedResource{
+			kind:        "hypervisor",
+			description: fmt.Sprintf("process %d of pod %s (pod does not exist)", pid, podID),
+			reclaim: func() error {
+				return killHypervisor(pid)
+			},
+		})
+	}
+
+	return leaked, nil
+}
+
+// killHypervisor kills the hypervisor with the specified PID and waits
+// for it to exit, so that the resources it uses are released.
+func killHypervisor(pid int) error {
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+		if err == syscall.ESRCH {
+			return nil
+		}
+
+		return err
+	}
+
+	for deadline := time.Now().Add(hypervisorExitTimeout); processRunning(pid); {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("process %d did not exit", pid)
+		}
+
+		time.Sleep(killPollInterval)
+	}
+
+	return nil
+}
+
+// unescapeMountPath decodes the octal escapes (such as "\040" for a
+// space) used in the paths of /proc/*/mountinfo.
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+
+	var b bytes.Buffer
+
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if n, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+
+		b.WriteByte(path[i])
+	}
+
+	return b.String()
+}
+
+// mountPoints returns the mount points of the runtime mount namespace.
+func mountPoints() ([]string, error) {
+	f, err := os.Open(mountInfoFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var points []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		point := unescapeMountPath(fields[4])
+		if !seen[point] {
+			seen[point] = true
+			points = append(points, point)
+		}
+	}
+
+	return points, scanner.Err()
+}
+
+// byDepth sorts mount points from the most to the least nested.
+type byDepth []string
+
+func (p byDepth) Len() int           { return len(p) }
+func (p byDepth) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byDepth) Less(i, j int) bool { return len(p[i]) > len(p[j]) }
+
+// findLeakedMounts returns the mounts in the directory shared with the
+// VMs which belong to a pod or container which is stopped or does not
+// exist.
+func findLeakedMounts(v *podsView) ([]leakedResource, error) {
+	points, err := mountPoints()
+	if err != nil {
+		return nil, err
+	}
+
+	sharedDir := filepath.Clean(vc.HyperSharedDir())
+
+	// unmount nested mounts first
+	sort.Stable(byDepth(points))
+
+	var leaked []leakedResource
+
+	for _, point := range points {
+		rel, err := filepath.Rel(sharedDir, point)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		// The mounts of a container are either in the container
+		// directory or prefixed with the container ID.
+		fields := strings.SplitN(rel, string(filepath.Separator), 3)
+		if len(fields) < 2 {
+			continue
+		}
+
+		podID, name := fields[0], fields[1]
+
+		reason := v.leakReason(podID)
+
+		if reason == "" {
+			for _, c := range v.pods[podID].ContainersStatus {
+				if (name == c.ID || strings.HasPrefix(name, c.ID+"-")) && c.State.State == vc.StateStopped {
+					reason = fmt.Sprintf("container %s is stopped", c.ID)
+					break
+				}
+			}
+		}
+
+		if reason == "" {
+			continue
+		}
+
+		point := point
+
+		leaked = append(leaked, leakedResource{
+			kind:        "mount",
+			description: fmt.Sprintf("%s (%s)", point, reason),
+			reclaim: func() error {
+				return unix.Unmount(point, unix.MNT_DETACH)
+			},
+		})
+	}
+
+	return leaked, nil
+}
+
+// netnsInUse returns the inode numbers of the network namespaces used
+// by a process, except for the leaked hypervisors which are reclaimed
+// first.
+func netnsInUse(v *podsView) (map[uint64]bool, error) {
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := make(map[uint64]bool)
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || v.hypervisors[pid] {
+			continue
+		}
+
+		var st syscall.Stat_t
+		if err := syscall.Stat(filepath.Join(procDir, entry.Name(), "ns", "net"), &st); err != nil {
+			continue
+		}
+
+		inUse[st.Ino] = true
+	}
+
+	return inUse, nil
+}
+
+// netnsTaps returns the names of the TAP interfaces created by
+// virtcontainers in the specified network namespace.
+func netnsTaps(path string) ([]string, error) {
+	var taps []string
+
+	err := ns.WithNetNSPath(path, func(ns.NetNS) error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return err
+		}
+
+		for _, link := range links {
+			name := link.Attrs().Name
+
+			if link.Type() == "tuntap" && tapNameRegex.MatchString(name) {
+				taps = append(taps, name)
+			}
+		}
+
+		return nil
+	})
+
+	return taps, err
+}
+
+// findLeakedNetns returns the network namespaces containing the TAP
+// interfaces of a VM which are neither used by a pod nor by any process.
+func findLeakedNetns(v *podsView) ([]leakedResource, error) {
+	entries, err := ioutil.ReadDir(netnsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	points, err := mountPoints()
+	if err != nil {
+		return nil, err
+	}
+
+	mounted := make(map[string]bool)
+	for _, point := range points {
+		mounted[point] = true
+	}
+
+	inUse, err := netnsInUse(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var leaked []leakedResource
+
+	for _, entry := range entries {
+		path := filepath.Join(netnsDir, entry.Name())
+
+		if v.netns[path] || !mounted[path] {
+			continue
+		}
+
+		var st syscall.Stat_t
+		if err := syscall.Stat(path, &st); err != nil || inUse[st.Ino] {
+			continue
+		}
+
+		taps, err := netnsTaps(path)
+		if err != nil {
+			ccLog.Warnf("Cannot check network namespace %s: %v", path, err)
+			continue
+		}
+
+		// not created for a VM
+		if len(taps) == 0 {
+			continue
+		}
+
+		leaked = append(leaked, leakedResource{
+			kind:        "netns",
+			description: fmt.Sprintf("%s with %s (not used by any pod or process)", path, strings.Join(taps, ", ")),
+			reclaim: func() error {
+				if err := unix.Unmount(path, unix.MNT_DETACH); err != nil {
+					return err
+				}
+
+				return os.Remove(path)
+			},
+		})
+	}
+
+	return leaked, nil
+}
+
+func cgroupsRecordPath(containerID string) string {
+	return filepath.Join(cgroupsRecordDir, containerID+".json")
+}
+
+// recordCgroups records the cgroups directories created for the
+// specified container.
+func recordCgroups(podID, containerID string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(cgroupsRecord{
+		PodID: podID,
+		Paths: paths,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(cgroupsRecordDir, cgroupsDirMode); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(cgroupsRecordPath(containerID), data, cgroupsFileMode)
+}
+
+// removeCgroupsRecord removes the record of the cgroups directories
+// created for the specified container, if any.
+func removeCgroupsRecord(containerID string) error {
+	if err := os.Remove(cgroupsRecordPath(containerID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// readCgroupsRecords returns the records of the cgroups directories
+// created for each container.
+func readCgroupsRecords() (map[string]cgroupsRecord, error) {
+	entries, err := ioutil.ReadDir(cgroupsRecordDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]cgroupsRecord)
+
+	for _, entry := range entries {
+		containerID := strings.TrimSuffix(entry.Name(), ".json")
+		if containerID == entry.Name() {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(cgroupsRecordDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var record cgroupsRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			ccLog.Warnf("Ignoring invalid cgroups record %s: %v", entry.Name(), err)
+			continue
+		}
+
+		records[containerID] = record
+	}
+
+	return records, nil
+}
+
+// findLeakedCgroups returns the cgroups directories created for
+// containers which no longer exist.
+func findLeakedCgroups(v *podsView) ([]leakedResource, error) {
+	records, err := readCgroupsRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var leaked []leakedResource
+
+	for _, containerID := range ids {
+		record := records[containerID]
+
+		if _, ok := v.containers[containerID]; ok {
+			continue
+		}
+
+		// The pod exists but its state cannot be read, so it is not
+		// known whether the container exists.
+		if _, ok := v.pods[record.PodID]; !ok && v.podKnown(record.PodID) {
+			continue
+		}
+
+		var paths []string
+		for _, path := range record.Paths {
+			if _, err := os.Stat(path); err == nil {
+				paths = append(paths, path)
+			}
+		}
+
+		description := fmt.Sprintf("record of container %s (container does not exist)", containerID)
+		if len(paths) > 0 {
+			description = fmt.Sprintf("%s of container %s (container does not exist)", strings.Join(paths, ", "), containerID)
+		}
+
+		containerID := containerID
+
+		leaked = append(leaked, leakedResource{
+			kind:        "cgroups",
+			description: description,
+			reclaim: func() error {
+				if len(paths) > 0 {
+					if err := removeCgroupsPath(paths); err != nil {
+						return err
+					}
+				}
+
+				return removeCgroupsRecord(containerID)
+			},
+		})
+	}
+
+	return leaked, nil
+}
@@ -0,0 +1,315 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+// setTestCgroupsRecordDir makes the cgroups records use a temporary
+// directory and returns a function to restore the original one.
+func setTestCgroupsRecordDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir(testDir, "cgroups-records-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := cgroupsRecordDir
+	cgroupsRecordDir = dir
+
+	return func() {
+		cgroupsRecordDir = saved
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHypervisorPodID(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		args     []string
+		expected string
+	}
+
+	data := []testData{
+		{nil, ""},
+		{[]string{"qemu"}, ""},
+		{[]string{"qemu", "-name"}, ""},
+		{[]string{"qemu", "-name", "vm"}, ""},
+		{[]string{"qemu", "-name", "pod-foo", "-uuid", "bar"}, "foo"},
+		{[]string{"qemu", "-uuid", "bar", "-name", "pod-foo"}, "foo"},
+	}
+
+	for _, d := range data {
+		assert.Equal(d.expected, hypervisorPodID(d.args), "args %v", d.args)
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("/foo/bar", unescapeMountPath("/foo/bar"))
+	assert.Equal("/foo bar", unescapeMountPath(`/foo\040bar`))
+	assert.Equal("/foo\tbar\\", unescapeMountPath(`/foo\011bar\134`))
+	assert.Equal(`/foo\9`, unescapeMountPath(`/foo\9`))
+}
+
+func TestFindLeakedMounts(t *testing.T) {
+	assert := assert.New(t)
+
+	sharedDir := vc.HyperSharedDir()
+
+	mountInfo := filepath.Join(testDir, "mountinfo")
+	lines := []string{
+		"22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw",
+		fmt.Sprintf("100 22 8:1 /a %s rw - ext4 /dev/sda1 rw", filepath.Join(sharedDir, "running", "c1", "rootfs")),
+		fmt.Sprintf("101 22 8:1 /b %s rw - ext4 /dev/sda1 rw", filepath.Join(sharedDir, "running", "c2", "rootfs")),
+		fmt.Sprintf("102 22 8:1 /c %s rw - ext4 /dev/sda1 rw", filepath.Join(sharedDir, "running", "c2-0123456789abcdef-data")),
+		fmt.Sprintf("103 22 8:1 /d %s rw - ext4 /dev/sda1 rw", filepath.Join(sharedDir, "stopped", "c3", "rootfs")),
+		fmt.Sprintf("104 22 8:1 /e %s rw - ext4 /dev/sda1 rw", filepath.Join(sharedDir, "gone", "c4", "rootfs")),
+	}
+
+	err := ioutil.WriteFile(mountInfo, []byte(strings.Join(lines, "\n")+"\n"), testFileMode)
+	assert.NoError(err)
+	defer os.Remove(mountInfo)
+
+	savedMountInfoFile := mountInfoFile
+	mountInfoFile = mountInfo
+	defer func() { mountInfoFile = savedMountInfoFile }()
+
+	v := newPodsView([]vc.PodStatus{
+		{
+			ID:    "running",
+			State: vc.State{State: vc.StateRunning},
+			ContainersStatus: []vc.ContainerStatus{
+				{ID: "c1", State: vc.State{State: vc.StateRunning}},
+				{ID: "c2", State: vc.State{State: vc.StateStopped}},
+			},
+		},
+		{
+			ID:    "stopped",
+			State: vc.State{State: vc.StateStopped},
+			ContainersStatus: []vc.ContainerStatus{
+				{ID: "c3", State: vc.State{State: vc.StateStopped}},
+			},
+		},
+	})
+
+	leaked, err := findLeakedMounts(v)
+	assert.NoError(err)
+
+	var descriptions []string
+	for _, r := range leaked {
+		assert.Equal("mount", r.kind)
+		assert.NotNil(r.reclaim)
+		descriptions = append(descriptions, r.description)
+	}
+
+	// sorted by decreasing mount point length
+	assert.Equal([]string{
+		filepath.Join(sharedDir, "running", "c2-0123456789abcdef-data") + " (container c2 is stopped)",
+		filepath.Join(sharedDir, "running", "c2", "rootfs") + " (container c2 is stopped)",
+		filepath.Join(sharedDir, "stopped", "c3", "rootfs") + " (pod is stopped)",
+		filepath.Join(sharedDir, "gone", "c4", "rootfs") + " (pod does not exist)",
+	}, descriptions)
+}
+
+func TestFindLeakedHypervisors(t *testing.T) {
+	assert := assert.New(t)
+
+	hypervisorPath, err := exec.LookPath("sh")
+	assert.NoError(err)
+
+	// a process looking like the hypervisor of pod "leaked"
+	cmd := exec.Command(hypervisorPath, "-c", "sleep 60; :", "sh", "-name", "pod-leaked")
+	err = cmd.Start()
+	assert.NoError(err)
+
+	find := func(v *podsView) *leakedResource {
+		leaked, err := findLeakedHypervisors(v, hypervisorPath)
+		assert.NoError(err)
+
+		for _, r := range leaked {
+			if strings.Contains(r.description, fmt.Sprintf("process %d ", cmd.Process.Pid)) {
+				return &r
+			}
+		}
+
+		return nil
+	}
+
+	// running pod
+	v := newPodsView([]vc.PodStatus{
+		{ID: "leaked", State: vc.State{State: vc.StateRunning}},
+	})
+	assert.Nil(find(v))
+
+	// stopped pod: reported only
+	v = newPodsView([]vc.PodStatus{
+		{ID: "leaked", State: vc.State{State: vc.StateStopped}},
+	})
+	r := find(v)
+	if assert.NotNil(r) {
+		assert.Nil(r.reclaim)
+		assert.False(v.hypervisors[cmd.Process.Pid])
+	}
+
+	// pod does not exist
+	v = newPodsView(nil)
+	r = find(v)
+	if assert.NotNil(r) {
+		assert.Equal("hypervisor", r.kind)
+		assert.True(v.hypervisors[cmd.Process.Pid])
+
+		err = r.reclaim()
+		assert.NoError(err)
+		assert.False(processRunning(cmd.Process.Pid))
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+}
+
+func TestCgroupsRecords(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setTestCgroupsRecordDir(t)()
+
+	// nothing to record
+	err := recordCgroups("pod", "foo", nil)
+	assert.NoError(err)
+
+	records, err := readCgroupsRecords()
+	assert.NoError(err)
+	assert.Empty(records)
+
+	err = recordCgroups("pod", "foo", []string{"/a", "/b"})
+	assert.NoError(err)
+
+	// ignored
+	err = ioutil.WriteFile(filepath.Join(cgroupsRecordDir, "bar.json"), []byte("invalid"), testFileMode)
+	assert.NoError(err)
+
+	records, err = readCgroupsRecords()
+	assert.NoError(err)
+	assert.Equal(map[string]cgroupsRecord{
+		"foo": {PodID: "pod", Paths: []string{"/a", "/b"}},
+	}, records)
+
+	err = removeCgroupsRecord("foo")
+	assert.NoError(err)
+
+	err = removeCgroupsRecord("foo")
+	assert.NoError(err)
+
+	records, err = readCgroupsRecords()
+	assert.NoError(err)
+	assert.Empty(records)
+}
+
+func TestFindLeakedCgroups(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setTestCgroupsRecordDir(t)()
+
+	cgroupsPath, err := ioutil.TempDir(testDir, "cgroups-path-")
+	assert.NoError(err)
+	defer os.RemoveAll(cgroupsPath)
+
+	assert.NoError(recordCgroups("pod", "known", []string{"/does/not/exist"}))
+	assert.NoError(recordCgroups("pod", "deleted", []string{cgroupsPath}))
+	assert.NoError(recordCgroups("gone", "gone", []string{"/does/not/exist"}))
+
+	v := newPodsView([]vc.PodStatus{
+		{
+			ID: "pod",
+			ContainersStatus: []vc.ContainerStatus{
+				{ID: "known"},
+			},
+		},
+	})
+
+	leaked, err := findLeakedCgroups(v)
+	assert.NoError(err)
+
+	if assert.Len(leaked, 2) {
+		assert.Equal(cgroupsPath+" of container deleted (container does not exist)", leaked[0].description)
+		assert.Equal("record of container gone (container does not exist)", leaked[1].description)
+
+		for _, r := range leaked {
+			assert.NoError(r.reclaim())
+		}
+	}
+
+	_, err = os.Stat(cgroupsPath)
+	assert.True(os.IsNotExist(err))
+
+	records, err := readCgroupsRecords()
+	assert.NoError(err)
+	assert.Equal([]string{"known"}, func() (ids []string) {
+		for id := range records {
+			ids = append(ids, id)
+		}
+		return ids
+	}())
+}
+
+func TestGC(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setTestCgroupsRecordDir(t)()
+
+	dir, err := ioutil.TempDir(testDir, "netns-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedNetnsDir := netnsDir
+	netnsDir = dir
+	defer func() { netnsDir = savedNetnsDir }()
+
+	hypervisorPath := filepath.Join(testDir, "no-such-hypervisor")
+
+	assert.NoError(recordCgroups("gc-test-pod", "gc-test-container", []string{"/does/not/exist"}))
+
+	var out bytes.Buffer
+
+	err = gc(hypervisorPath, true, &out)
+	assert.NoError(err)
+	assert.Contains(out.String(), "Would reclaim cgroups: record of container gc-test-container")
+
+	records, err := readCgroupsRecords()
+	assert.NoError(err)
+	assert.Len(records, 1)
+
+	out.Reset()
+
+	err = gc(hypervisorPath, false, &out)
+	assert.NoError(err)
+	assert.Contains(out.String(), "Reclaimed cgroups: record of container gc-test-container")
+
+	records, err = readCgroupsRecords()
+	assert.NoError(err)
+	assert.Empty(records)
+}
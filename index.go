@@ -0,0 +1,314 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	vc "github.com/containers/virtcontainers"
+)
+
+// The container index maps the ID of every container to the ID of the
+// pod it belongs to, so that a container can be found without loading
+// every pod. It is stored in the root directory, and is rebuilt from
+// the pods if it is missing or invalid.
+const (
+	containerIndexFileName = "containers.json"
+	containerIndexLockName = "containers.lock"
+	containerIndexFileMode = os.FileMode(0640)
+	containerIndexDirMode  = os.FileMode(0750)
+)
+
+// variables to allow tests to modify the values
+var (
+	containerIndexDir = defaultRootDirectory
+)
+
+// containerIndexEntry records the pod a container belongs to.
+type containerIndexEntry struct {
+	ID    string `json:"id"`
+	PodID string `json:"podID"`
+}
+
+// containerIndex is the list of all the containers, sorted by ID so
+// that the containers whose ID starts with a given prefix can be found
+// with a binary search.
+type containerIndex struct {
+	Containers []containerIndexEntry `json:"containers"`
+}
+
+func containerIndexPath() string {
+	return filepath.Join(containerIndexDir, containerIndexFileName)
+}
+
+// search returns the position of the first container whose ID is not
+// lower than id.
+func (index *containerIndex) search(id string) int {
+	return sort.Search(len(index.Containers), func(i int) bool {
+		return index.Containers[i].ID >= id
+	})
+}
+
+// lookup returns the container whose ID is, or starts with, prefix. An
+// exact match is preferred; otherwise an error is returned if several
+// containers have an ID starting with prefix. An empty entry is
+// returned if no container matches.
+func (index *containerIndex) lookup(prefix string) (containerIndexEntry, error) {
+	i := index.search(prefix)
+	if i == len(index.Containers) || !strings.HasPrefix(index.Containers[i].ID, prefix) {
+		return containerIndexEntry{}, nil
+	}
+
+	if index.Containers[i].ID != prefix &&
+		i+1 < len(index.Containers) &&
+		strings.HasPrefix(index.Containers[i+1].ID, prefix) {
+		return containerIndexEntry{}, errPrefixContIDNotUnique
+	}
+
+	return index.Containers[i], nil
+}
+
+// add adds a container to the index, replacing any existing entry with
+// the same ID.
+func (index *containerIndex) add(containerID, podID string) {
+	entry := containerIndexEntry{ID: containerID, PodID: podID}
+
+	i := index.search(containerID)
+	if i < len(index.Containers) && index.Containers[i].ID == containerID {
+		index.Containers[i] = entry
+		return
+	}
+
+	index.Containers = append(index.Containers, containerIndexEntry{})
+	copy(index.Containers[i+1:], index.Containers[i:])
+	index.Containers[i] = entry
+}
+
+// remove removes the containers for which match returns true.
+func (index *containerIndex) remove(match func(entry containerIndexEntry) bool) {
+	kept := index.Containers[:0]
+
+	for _, entry := range index.Containers {
+		if !match(entry) {
+			kept = append(kept, entry)
+		}
+	}
+
+	index.Containers = kept
+}
+
+// valid checks that the containers are sorted by ID, without duplicates.
+func (index *containerIndex) valid() bool {
+	for i := 1; i < len(index.Containers); i++ {
+		if index.Containers[i-1].ID >= index.Containers[i].ID {
+			return false
+		}
+	}
+
+	for _, entry := range index.Containers {
+		if entry.ID == "" || entry.PodID == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lockContainerIndex locks the container index, using a shared or an
+// exclusive lock (syscall.LOCK_SH or syscall.LOCK_EX), and returns the
+// function releasing the lock.
+func lockContainerIndex(how int) (func(), error) {
+	if err := os.MkdirAll(containerIndexDir, containerIndexDirMode); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(containerIndexDir, containerIndexLockName), os.O_RDWR|os.O_CREATE, containerIndexFileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// readContainerIndex reads the container index. The caller must hold
+// the index lock.
+func readContainerIndex() (*containerIndex, error) {
+	data, err := ioutil.ReadFile(containerIndexPath())
+	if err != nil {
+		return nil, err
+	}
+
+	var index containerIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("Invalid container index %s: %v", containerIndexPath(), err)
+	}
+
+	if !index.valid() {
+		return nil, fmt.Errorf("Invalid container index %s: entries not sorted or incomplete", containerIndexPath())
+	}
+
+	return &index, nil
+}
+
+// writeContainerIndex replaces the container index. The caller must
+// hold the exclusive index lock.
+func writeContainerIndex(index *containerIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	// Readers must never see a partially written index.
+	tmp := containerIndexPath() + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, containerIndexFileMode); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, containerIndexPath()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// buildContainerIndex builds the container index from the pods.
+func buildContainerIndex() (*containerIndex, error) {
+	pods, err := vc.ListPod()
+	if err != nil {
+		return nil, err
+	}
+
+	index := &containerIndex{}
+
+	for _, pod := range pods {
+		for _, container := range pod.ContainersStatus {
+			index.add(container.ID, pod.ID)
+		}
+	}
+
+	return index, nil
+}
+
+// rebuildContainerIndex rebuilds the container index from the pods and
+// stores it.
+func rebuildContainerIndex() (*containerIndex, error) {
+	unlock, err := lockContainerIndex(syscall.LOCK_EX)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	index, err := buildContainerIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeContainerIndex(index); err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// loadContainerIndex returns the container index, rebuilding it if it
+// is missing or invalid.
+func loadContainerIndex() (*containerIndex, error) {
+	unlock, err := lockContainerIndex(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := readContainerIndex()
+	unlock()
+
+	if err == nil {
+		return index, nil
+	}
+
+	if !os.IsNotExist(err) {
+		ccLog.Warnf("Rebuilding container index: %v", err)
+	}
+
+	return rebuildContainerIndex()
+}
+
+// updateContainerIndex applies update to the container index and
+// stores it, rebuilding the index first if it is missing or invalid.
+func updateContainerIndex(update func(index *containerIndex)) error {
+	unlock, err := lockContainerIndex(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	index, err := readContainerIndex()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			ccLog.Warnf("Rebuilding container index: %v", err)
+		}
+
+		if index, err = buildContainerIndex(); err != nil {
+			return err
+		}
+	}
+
+	update(index)
+
+	return writeContainerIndex(index)
+}
+
+// indexContainer records that the specified container belongs to the
+// specified pod.
+func indexContainer(containerID, podID string) error {
+	return updateContainerIndex(func(index *containerIndex) {
+		index.add(containerID, podID)
+	})
+}
+
+// unindexContainer removes the specified container from the index.
+func unindexContainer(containerID string) error {
+	return updateContainerIndex(func(index *containerIndex) {
+		index.remove(func(entry containerIndexEntry) bool {
+			return entry.ID == containerID
+		})
+	})
+}
+
+// unindexPod removes all the containers of the specified pod from the
+// index.
+func unindexPod(podID string) error {
+	return updateContainerIndex(func(index *containerIndex) {
+		index.remove(func(entry containerIndexEntry) bool {
+			return entry.PodID == podID
+		})
+	})
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setTestContainerIndexDir makes the container index use a temporary
+// directory and returns a function to restore the original one.
+func setTestContainerIndexDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir(testDir, "container-index-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := containerIndexDir
+	containerIndexDir = dir
+
+	return func() {
+		containerIndexDir = saved
+		os.RemoveAll(dir)
+	}
+}
+
+func TestContainerIndexAdd(t *testing.T) {
+	assert := assert.New(t)
+
+	index := &containerIndex{}
+
+	index.add("b", "pod1")
+	index.add("c", "pod1")
+	index.add("a", "pod2")
+	index.add("bb", "pod2")
+
+	// replaces the existing entry
+	index.add("c", "pod3")
+
+	assert.Equal([]containerIndexEntry{
+		{ID: "a", PodID: "pod2"},
+		{ID: "b", PodID: "pod1"},
+		{ID: "bb", PodID: "pod2"},
+		{ID: "c", PodID: "pod3"},
+	}, index.Containers)
+	assert.True(index.valid())
+}
+
+func TestContainerIndexRemove(t *testing.T) {
+	assert := assert.New(t)
+
+	index := &containerIndex{}
+
+	index.add("a", "pod1")
+	index.add("b", "pod2")
+	index.add("c", "pod1")
+
+	index.remove(func(entry containerIndexEntry) bool {
+		return entry.PodID == "pod1"
+	})
+
+	assert.Equal([]containerIndexEntry{
+		{ID: "b", PodID: "pod2"},
+	}, index.Containers)
+}
+
+func TestContainerIndexLookup(t *testing.T) {
+	assert := assert.New(t)
+
+	index := &containerIndex{}
+
+	index.add("abc", "pod1")
+	index.add("abcdef", "pod1")
+	index.add("abd", "pod2")
+	index.add("xyz", "pod3")
+
+	type testData struct {
+		prefix      string
+		expected    string
+		expectError bool
+	}
+
+	data := []testData{
+		{"abc", "abc", false},
+		{"abcd", "abcdef", false},
+		{"abd", "abd", false},
+		{"x", "xyz", false},
+		{"ab", "", true},
+		{"a", "", true},
+		{"b", "", false},
+		{"z", "", false},
+		{"abcdefg", "", false},
+	}
+
+	for _, d := range data {
+		entry, err := index.lookup(d.prefix)
+		if d.expectError {
+			assert.Equal(errPrefixContIDNotUnique, err, "prefix %q", d.prefix)
+			continue
+		}
+
+		assert.NoError(err, "prefix %q", d.prefix)
+		assert.Equal(d.expected, entry.ID, "prefix %q", d.prefix)
+	}
+
+	entry, err := (&containerIndex{}).lookup("abc")
+	assert.NoError(err)
+	assert.Equal(containerIndexEntry{}, entry)
+}
+
+func TestContainerIndexValid(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True((&containerIndex{}).valid())
+
+	assert.False((&containerIndex{Containers: []containerIndexEntry{
+		{ID: "b", PodID: "pod"},
+		{ID: "a", PodID: "pod"},
+	}}).valid())
+
+	assert.False((&containerIndex{Containers: []containerIndexEntry{
+		{ID: "a", PodID: "pod"},
+		{ID: "a", PodID: "pod"},
+	}}).valid())
+
+	assert.False((&containerIndex{Containers: []containerIndexEntry{
+		{ID: "a"},
+	}}).valid())
+}
+
+func TestUpdateContainerIndex(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setTestContainerIndexDir(t)()
+
+	// no index yet
+	_, err := readContainerIndex()
+	assert.True(os.IsNotExist(err))
+
+	assert.NoError(indexContainer("foo", "pod1"))
+	assert.NoError(indexContainer("bar", "pod1"))
+	assert.NoError(indexContainer("baz", "pod2"))
+
+	index, err := readContainerIndex()
+	assert.NoError(err)
+	assert.Equal([]containerIndexEntry{
+		{ID: "bar", PodID: "pod1"},
+		{ID: "baz", PodID: "pod2"},
+		{ID: "foo", PodID: "pod1"},
+	}, index.Containers)
+
+	assert.NoError(unindexContainer("baz"))
+	assert.NoError(unindexContainer("baz"))
+
+	index, err = loadContainerIndex()
+	assert.NoError(err)
+	assert.Len(index.Containers, 2)
+
+	assert.NoError(unindexPod("pod1"))
+
+	index, err = loadContainerIndex()
+	assert.NoError(err)
+	assert.Empty(index.Containers)
+}
+
+func TestLoadContainerIndexRebuild(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setTestContainerIndexDir(t)()
+
+	for _, data := range []string{"invalid", `{"containers":[{"id":"b","podID":"p"},{"id":"a","podID":"p"}]}`} {
+		err := ioutil.WriteFile(containerIndexPath(), []byte(data), testFileMode)
+		assert.NoError(err)
+
+		_, err = readContainerIndex()
+		assert.Error(err)
+
+		// rebuilt from the pods
+		index, err := loadContainerIndex()
+		assert.NoError(err)
+		assert.True(index.valid())
+
+		_, err = readContainerIndex()
+		assert.NoError(err)
+	}
+}
+
+func TestLookupContainerRebuild(t *testing.T) {
+	assert := assert.New(t)
+
+	defer setTestContainerIndexDir(t)()
+
+	// stale entries for containers which no longer exist
+	assert.NoError(indexContainer("abc1", "pod1"))
+	assert.NoError(indexContainer("abc2", "pod1"))
+
+	// a miss or an ambiguous prefix does not rebuild the index
+	entry, err := lookupContainer("xyz", false)
+	assert.NoError(err)
+	assert.Empty(entry.ID)
+
+	_, err = lookupContainer("abc", false)
+	assert.Equal(errPrefixContIDNotUnique, err)
+
+	index, err := readContainerIndex()
+	assert.NoError(err)
+	assert.Len(index.Containers, 2)
+
+	// the rebuild finds no container
+	entry, err = lookupContainer("abc", true)
+	assert.NoError(err)
+	assert.Empty(entry.ID)
+
+	index, err = readContainerIndex()
+	assert.NoError(err)
+	assert.Empty(index.Containers)
+}
@@ -17,8 +17,13 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	vc "github.com/containers/virtcontainers"
 	"github.com/urfave/cli"
@@ -30,20 +35,48 @@ var killCLICommand = cli.Command{
 	ArgsUsage: `<container-id> [signal]
 
    <container-id> is the name for the instance of the container
-   [signal] is the signal to be sent to the init process (default: SIGTERM)
+   [signal] is the signal to be sent to the init process (default: SIGTERM),
+            specified by name (see --list), number or, for real-time
+            signals, as SIGRTMIN+n or SIGRTMAX-n
 
 EXAMPLE:
    If the container id is "ubuntu01" the following will send a "KILL" signal
    to the init process of the "ubuntu01" container:
 	 
-       # ` + name + ` kill ubuntu01 KILL`,
+       # ` + name + ` kill ubuntu01 KILL
+
+   The following will send a "TERM" signal, wait up to 10 seconds for the
+   container to stop, then send a "KILL" signal if it is still running and
+   finally stop the pod VM:
+
+       # ` + name + ` kill --timeout 10s --then KILL --stop-pod ubuntu01 TERM`,
 	Flags: []cli.Flag{
 		cli.BoolFlag{
 			Name:  "all, a",
 			Usage: "send the specified signal to all processes inside the container",
 		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "wait up to the specified duration (for example \"10s\") for the container to stop",
+		},
+		cli.StringFlag{
+			Name:  "then",
+			Usage: "signal to send if the container has not stopped within the timeout (for example \"KILL\")",
+		},
+		cli.BoolFlag{
+			Name:  "stop-pod",
+			Usage: "stop the pod VM once the container has stopped if no other container in the pod is running",
+		},
+		cli.BoolFlag{
+			Name:  "list, l",
+			Usage: "list the supported signals",
+		},
 	},
 	Action: func(context *cli.Context) error {
+		if context.Bool("list") {
+			return listSignals(os.Stdout)
+		}
+
 		args := context.Args()
 		if args.Present() == false {
 			return fmt.Errorf("Missing container ID")
@@ -55,49 +88,53 @@ EXAMPLE:
 			signal = "SIGTERM"
 		}
 
-		return kill(args.First(), signal, context.Bool("all"))
+		return kill(args.First(), signal, context.Bool("all"), killOptions{
+			timeout: context.Duration("timeout"),
+			then:    context.String("then"),
+			stopPod: context.Bool("stop-pod"),
+		})
 	},
 }
 
-var signals = map[string]syscall.Signal{
-	"SIGABRT":   syscall.SIGABRT,
-	"SIGALRM":   syscall.SIGALRM,
-	"SIGBUS":    syscall.SIGBUS,
-	"SIGCHLD":   syscall.SIGCHLD,
-	"SIGCLD":    syscall.SIGCLD,
-	"SIGCONT":   syscall.SIGCONT,
-	"SIGFPE":    syscall.SIGFPE,
-	"SIGHUP":    syscall.SIGHUP,
-	"SIGILL":    syscall.SIGILL,
-	"SIGINT":    syscall.SIGINT,
-	"SIGIO":     syscall.SIGIO,
-	"SIGIOT":    syscall.SIGIOT,
-	"SIGKILL":   syscall.SIGKILL,
-	"SIGPIPE":   syscall.SIGPIPE,
-	"SIGPOLL":   syscall.SIGPOLL,
-	"SIGPROF":   syscall.SIGPROF,
-	"SIGPWR":    syscall.SIGPWR,
-	"SIGQUIT":   syscall.SIGQUIT,
-	"SIGSEGV":   syscall.SIGSEGV,
-	"SIGSTKFLT": syscall.SIGSTKFLT,
-	"SIGSTOP":   syscall.SIGSTOP,
-	"SIGSYS":    syscall.SIGSYS,
-	"SIGTERM":   syscall.SIGTERM,
-	"SIGTRAP":   syscall.SIGTRAP,
-	"SIGTSTP":   syscall.SIGTSTP,
-	"SIGTTIN":   syscall.SIGTTIN,
-	"SIGTTOU":   syscall.SIGTTOU,
-	"SIGUNUSED": syscall.SIGUNUSED,
-	"SIGURG":    syscall.SIGURG,
-	"SIGUSR1":   syscall.SIGUSR1,
-	"SIGUSR2":   syscall.SIGUSR2,
-	"SIGVTALRM": syscall.SIGVTALRM,
-	"SIGWINCH":  syscall.SIGWINCH,
-	"SIGXCPU":   syscall.SIGXCPU,
-	"SIGXFSZ":   syscall.SIGXFSZ,
+// killOptions specify how kill waits for the container to stop.
+type killOptions struct {
+	// timeout is how long to wait for the container to stop. If zero,
+	// kill does not wait.
+	timeout time.Duration
+
+	// then is the signal sent if the container has not stopped within
+	// the timeout.
+	then string
+
+	// stopPod specifies that the pod VM should be stopped once the
+	// container has stopped, if no other container is running in it.
+	stopPod bool
 }
 
-func kill(containerID, signal string, all bool) error {
+// variables to allow tests to modify the values
+var (
+	// killPollInterval is how often the state of the container is
+	// checked while waiting for it to stop.
+	killPollInterval = 100 * time.Millisecond
+
+	killContainer   = vc.KillContainer
+	statusContainer = vc.StatusContainer
+	statusPod       = vc.StatusPod
+	stopPod         = vc.StopPod
+)
+
+// sigRtMin is the first real-time signal available to applications:
+// the C library reserves the first two real-time signals supported by
+// the kernel for its threads implementation.
+const sigRtMin = kernelSigRtMin + 2
+
+var rtSignalRegex = regexp.MustCompile(`^SIGRT(MIN|MAX)(?:([+-])([0-9]+))?$`)
+
+func kill(containerID, signal string, all bool, opts killOptions) (err error) {
+	audit := newAuditEntry("kill", containerID)
+	audit.Signal = auditSignal(signal)
+	defer func() { audit.finish(err) }()
+
 	// Checks the MUST and MUST NOT from OCI runtime specification
 	status, podID, err := getExistingContainerInfo(containerID)
 	if err != nil {
@@ -105,50 +142,234 @@ func kill(containerID, signal string, all bool) error {
 	}
 
 	containerID = status.ID
+	audit.ContainerID = containerID
+	audit.PodID = podID
 
 	signum, err := processSignal(signal)
 	if err != nil {
 		return err
 	}
 
+	var thenSignum syscall.Signal
+
+	if opts.then != "" {
+		if opts.timeout <= 0 {
+			return fmt.Errorf("A timeout must be specified with --then")
+		}
+
+		if thenSignum, err = processSignal(opts.then); err != nil {
+			return err
+		}
+	}
+
 	// container MUST be created or running
 	if status.State.State != vc.StateReady && status.State.State != vc.StateRunning {
 		return fmt.Errorf("Container %s not ready or running, cannot send a signal", containerID)
 	}
 
-	if err := vc.KillContainer(podID, containerID, signum, all); err != nil {
+	return signalContainer(podID, containerID, signum, thenSignum, all, opts, audit)
+}
+
+// signalContainer sends the signal to the container, escalating to the
+// --then signal and stopping the pod VM as specified by the options.
+// The signals sent and the actions performed are recorded in the audit
+// entry.
+func signalContainer(podID, containerID string, signum, thenSignum syscall.Signal, all bool, opts killOptions, audit *auditEntry) error {
+	if err := killContainer(podID, containerID, signum, all); err != nil {
+		return err
+	}
+
+	audit.recordSignal(signum)
+
+	if opts.timeout <= 0 {
+		return nil
+	}
+
+	stopped, err := waitContainerStopped(podID, containerID, opts.timeout)
+	if err != nil {
 		return err
 	}
 
+	if !stopped {
+		if opts.then == "" {
+			return fmt.Errorf("Container %s still running %v after signal %s", containerID, opts.timeout, signalName(signum))
+		}
+
+		ccLog.Infof("Container %s still running %v after signal %s, sending %s", containerID, opts.timeout, signalName(signum), opts.then)
+
+		if err := killContainer(podID, containerID, thenSignum, all); err != nil {
+			return err
+		}
+
+		audit.recordSignal(thenSignum)
+
+		if stopped, err = waitContainerStopped(podID, containerID, opts.timeout); err != nil {
+			return err
+		}
+
+		if !stopped {
+			return fmt.Errorf("Container %s still running %v after signal %s", containerID, opts.timeout, opts.then)
+		}
+	}
+
+	if opts.stopPod {
+		podStopped, err := stopIdlePod(podID)
+		if err != nil {
+			return err
+		}
+
+		if podStopped {
+			audit.Actions = append(audit.Actions, auditActionStopPod)
+		}
+	}
+
 	return nil
 }
 
+// waitContainerStopped waits up to timeout for the container to stop
+// and returns true if it did.
+func waitContainerStopped(podID, containerID string, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		status, err := statusContainer(podID, containerID)
+		if err != nil {
+			return false, err
+		}
+
+		if status.State.State != vc.StateRunning {
+			return true, nil
+		}
+
+		if time.Now().After(deadline) {
+			return false, nil
+		}
+
+		time.Sleep(killPollInterval)
+	}
+}
+
+// stopIdlePod stops the pod VM if no container is running in it and
+// returns true if it did.
+func stopIdlePod(podID string) (bool, error) {
+	status, err := statusPod(podID)
+	if err != nil {
+		return false, err
+	}
+
+	if status.State.State != vc.StateRunning {
+		return false, nil
+	}
+
+	for _, c := range status.ContainersStatus {
+		if c.State.State == vc.StateRunning || c.State.State == vc.StatePaused {
+			ccLog.Debugf("Not stopping pod %s since container %s is %s", podID, c.ID, c.State.State)
+			return false, nil
+		}
+	}
+
+	if _, err = stopPod(podID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// processSignal converts a signal name (with or without the "SIG"
+// prefix, case insensitively), a real-time signal in the
+// SIGRTMIN+n/SIGRTMAX-n notation, or a signal number into a signal.
 func processSignal(signal string) (syscall.Signal, error) {
-	signum, signalOk := signals[signal]
-	if signalOk {
-		return signum, nil
+	name := strings.ToUpper(signal)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
 	}
 
-	// Support for short name signals (INT)
-	signum, signalOk = signals["SIG"+signal]
-	if signalOk {
+	if signum, ok := signals[name]; ok {
 		return signum, nil
 	}
 
+	if m := rtSignalRegex.FindStringSubmatch(name); m != nil {
+		return processRtSignal(signal, m[1], m[2], m[3])
+	}
+
 	// Support for numeric signals
 	s, err := strconv.Atoi(signal)
 	if err != nil {
 		return 0, fmt.Errorf("Failed to convert signal %s to int", signal)
 	}
 
-	signum = syscall.Signal(s)
-	// Check whether signal is valid or not
-	for _, sig := range signals {
-		if sig == signum {
-			// signal is a valid signal
-			return signum, nil
+	// The real-time signals reserved by the C library are not
+	// supported either.
+	if s <= 0 || s > sigRtMax || (s >= kernelSigRtMin && s < sigRtMin) {
+		return 0, fmt.Errorf("Signal %s is not supported", signal)
+	}
+
+	return syscall.Signal(s), nil
+}
+
+// processRtSignal converts a real-time signal specified relative to
+// SIGRTMIN or SIGRTMAX into a signal.
+func processRtSignal(signal, base, op, offset string) (syscall.Signal, error) {
+	n := 0
+
+	if offset != "" {
+		var err error
+		if n, err = strconv.Atoi(offset); err != nil {
+			return 0, fmt.Errorf("Invalid real-time signal %s", signal)
 		}
 	}
 
-	return 0, fmt.Errorf("Signal %s is not supported", signal)
+	if (base == "MIN" && op == "-") || (base == "MAX" && op == "+") {
+		return 0, fmt.Errorf("Invalid real-time signal %s: use SIGRTMIN+n or SIGRTMAX-n", signal)
+	}
+
+	signum := sigRtMin + n
+	if base == "MAX" {
+		signum = sigRtMax - n
+	}
+
+	if signum < sigRtMin || signum > sigRtMax {
+		return 0, fmt.Errorf("Real-time signal %s is out of range", signal)
+	}
+
+	return syscall.Signal(signum), nil
+}
+
+// signalName returns the name of the specified signal, using the
+// SIGRTMIN+n/SIGRTMAX-n notation for real-time signals.
+func signalName(signum syscall.Signal) string {
+	if name, ok := signalNames[signum]; ok {
+		return name
+	}
+
+	n := int(signum)
+
+	switch {
+	case n == sigRtMin:
+		return "SIGRTMIN"
+	case n == sigRtMax:
+		return "SIGRTMAX"
+	case n > sigRtMin && n <= (sigRtMin+sigRtMax)/2:
+		return fmt.Sprintf("SIGRTMIN+%d", n-sigRtMin)
+	case n > sigRtMin && n < sigRtMax:
+		return fmt.Sprintf("SIGRTMAX-%d", sigRtMax-n)
+	}
+
+	return ""
+}
+
+// listSignals writes the supported signals to w, one per line.
+func listSignals(w io.Writer) error {
+	for n := 1; n <= sigRtMax; n++ {
+		name := signalName(syscall.Signal(n))
+		if name == "" {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "%2d %s\n", n, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -15,8 +15,15 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"strings"
 	"syscall"
 	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestProcessSignal(t *testing.T) {
@@ -31,6 +38,25 @@ func TestProcessSignal(t *testing.T) {
 		{"SIGTERM", true, syscall.SIGTERM},
 		{"TERM", true, syscall.SIGTERM},
 		{"15", true, syscall.SIGTERM},
+		{"term", true, syscall.SIGTERM},
+		{"SIGCLD", true, syscall.SIGCHLD},
+		{"SIGUNUSED", true, syscall.SIGSYS},
+		{"UNUSED", true, syscall.SIGSYS},
+		{"0", false, 0},
+		{"65", false, 0},
+		{"32", false, 0},
+		{"33", false, 0},
+		{"34", true, syscall.Signal(34)},
+		{"SIGRTMIN", true, syscall.Signal(34)},
+		{"RTMIN+3", true, syscall.Signal(37)},
+		{"SIGRTMIN+3", true, syscall.Signal(37)},
+		{"SIGRTMAX", true, syscall.Signal(64)},
+		{"SIGRTMAX-2", true, syscall.Signal(62)},
+		{"SIGRTMIN+30", true, syscall.Signal(64)},
+		{"SIGRTMIN+31", false, 0},
+		{"SIGRTMAX-31", false, 0},
+		{"SIGRTMIN-1", false, 0},
+		{"SIGRTMAX+1", false, 0},
 	}
 
 	for _, test := range tests {
@@ -46,3 +72,202 @@ func TestProcessSignal(t *testing.T) {
 		}
 	}
 }
+
+// setTestKillFuncs replaces the virtcontainers functions used by kill
+// with ones returning the specified states and returns a function to
+// restore them. The container is running for the first runningPolls
+// status checks.
+func setTestKillFuncs(runningPolls int, podState vc.State, containers []vc.ContainerStatus) (stopped *int, restore func()) {
+	savedInterval := killPollInterval
+	savedStatusContainer := statusContainer
+	savedStatusPod := statusPod
+	savedStopPod := stopPod
+
+	killPollInterval = time.Millisecond
+	stopped = new(int)
+
+	polls := 0
+	statusContainer = func(podID, containerID string) (vc.ContainerStatus, error) {
+		polls++
+		if polls <= runningPolls {
+			return vc.ContainerStatus{ID: containerID, State: vc.State{State: vc.StateRunning}}, nil
+		}
+		return vc.ContainerStatus{ID: containerID, State: vc.State{State: vc.StateStopped}}, nil
+	}
+
+	statusPod = func(podID string) (vc.PodStatus, error) {
+		return vc.PodStatus{ID: podID, State: podState, ContainersStatus: containers}, nil
+	}
+
+	stopPod = func(podID string) (*vc.Pod, error) {
+		*stopped++
+		return nil, nil
+	}
+
+	return stopped, func() {
+		killPollInterval = savedInterval
+		statusContainer = savedStatusContainer
+		statusPod = savedStatusPod
+		stopPod = savedStopPod
+	}
+}
+
+func TestWaitContainerStopped(t *testing.T) {
+	assert := assert.New(t)
+
+	_, restore := setTestKillFuncs(3, vc.State{}, nil)
+	defer restore()
+
+	stopped, err := waitContainerStopped("pod", "container", time.Second)
+	assert.NoError(err)
+	assert.True(stopped)
+
+	_, restore = setTestKillFuncs(1000000, vc.State{}, nil)
+
+	stopped, err = waitContainerStopped("pod", "container", 20*time.Millisecond)
+	assert.NoError(err)
+	assert.False(stopped)
+
+	restore()
+
+	statusContainer = func(podID, containerID string) (vc.ContainerStatus, error) {
+		return vc.ContainerStatus{}, errors.New("status failed")
+	}
+
+	_, err = waitContainerStopped("pod", "container", time.Second)
+	assert.Error(err)
+}
+
+func TestStopIdlePod(t *testing.T) {
+	assert := assert.New(t)
+
+	running := vc.State{State: vc.StateRunning}
+	stoppedState := vc.State{State: vc.StateStopped}
+
+	type testData struct {
+		podState   vc.State
+		containers []vc.ContainerStatus
+		stopped    int
+	}
+
+	data := []testData{
+		{running, []vc.ContainerStatus{{ID: "a", State: stoppedState}}, 1},
+		{running, []vc.ContainerStatus{{ID: "a", State: stoppedState}, {ID: "b", State: running}}, 0},
+		{running, []vc.ContainerStatus{{ID: "a", State: vc.State{State: vc.StatePaused}}}, 0},
+		{stoppedState, []vc.ContainerStatus{{ID: "a", State: stoppedState}}, 0},
+	}
+
+	for i, d := range data {
+		stopped, restore := setTestKillFuncs(0, d.podState, d.containers)
+
+		podStopped, err := stopIdlePod("pod")
+		assert.NoError(err, "test %d", i)
+		assert.Equal(d.stopped, *stopped, "test %d", i)
+		assert.Equal(d.stopped == 1, podStopped, "test %d", i)
+
+		restore()
+	}
+}
+
+func TestSignalName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("SIGTERM", signalName(syscall.SIGTERM))
+	assert.Equal("SIGABRT", signalName(syscall.SIGABRT))
+	assert.Equal("", signalName(syscall.Signal(32)))
+	assert.Equal("SIGRTMIN", signalName(syscall.Signal(34)))
+	assert.Equal("SIGRTMIN+3", signalName(syscall.Signal(37)))
+	assert.Equal("SIGRTMIN+15", signalName(syscall.Signal(49)))
+	assert.Equal("SIGRTMAX-14", signalName(syscall.Signal(50)))
+	assert.Equal("SIGRTMAX", signalName(syscall.Signal(64)))
+
+	// every name can be parsed
+	for n := 1; n <= sigRtMax; n++ {
+		name := signalName(syscall.Signal(n))
+		if name == "" {
+			continue
+		}
+
+		signum, err := processSignal(name)
+		assert.NoError(err, "signal %s", name)
+		assert.Equal(syscall.Signal(n), signum, "signal %s", name)
+	}
+}
+
+func TestListSignals(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+
+	err := listSignals(&buf)
+	assert.NoError(err)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+	// the two real-time signals reserved by the C library are not listed
+	assert.Len(lines, sigRtMax-2)
+	assert.Equal(" 1 SIGHUP", lines[0])
+	assert.Equal("15 SIGTERM", lines[14])
+	assert.Equal("37 SIGRTMIN+3", lines[34])
+	assert.Equal("64 SIGRTMAX", lines[len(lines)-1])
+}
+
+func TestSignalContainerAudit(t *testing.T) {
+	assert := assert.New(t)
+
+	savedKillContainer := killContainer
+	defer func() {
+		killContainer = savedKillContainer
+	}()
+
+	var sent []syscall.Signal
+	killContainer = func(podID, containerID string, signal syscall.Signal, all bool) error {
+		sent = append(sent, signal)
+		return nil
+	}
+
+	running := vc.State{State: vc.StateRunning}
+	stoppedState := vc.State{State: vc.StateStopped}
+	containers := []vc.ContainerStatus{{ID: "container", State: stoppedState}}
+
+	// no escalation
+	_, restore := setTestKillFuncs(0, running, containers)
+
+	audit := &auditEntry{}
+	err := signalContainer("pod", "container", syscall.SIGTERM, 0, false, killOptions{}, audit)
+	assert.NoError(err)
+	assert.Equal("SIGTERM", audit.Signal)
+	assert.Equal([]string{"signal SIGTERM"}, audit.Actions)
+
+	restore()
+
+	// escalation
+	_, restore = setTestKillFuncs(1000000, running, containers)
+
+	opts := killOptions{
+		timeout: 10 * time.Millisecond,
+		then:    "KILL",
+		stopPod: true,
+	}
+
+	sent = nil
+	audit = &auditEntry{}
+	err = signalContainer("pod", "container", syscall.SIGTERM, syscall.SIGKILL, false, opts, audit)
+	assert.Error(err, "the container never stops")
+	assert.Equal([]syscall.Signal{syscall.SIGTERM, syscall.SIGKILL}, sent)
+	assert.Equal("SIGKILL", audit.Signal)
+	assert.Equal([]string{"signal SIGTERM", "signal SIGKILL"}, audit.Actions)
+
+	restore()
+
+	// pod stopped
+	_, restore = setTestKillFuncs(0, running, containers)
+	defer restore()
+
+	sent = nil
+	audit = &auditEntry{}
+	err = signalContainer("pod", "container", syscall.SIGTERM, syscall.SIGKILL, false, opts, audit)
+	assert.NoError(err)
+	assert.Equal("SIGTERM", audit.Signal)
+	assert.Equal([]string{"signal SIGTERM", "stop-pod"}, audit.Actions)
+}
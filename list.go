@@ -16,12 +16,20 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"os/user"
 	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
 	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"github.com/urfave/cli"
@@ -30,7 +38,45 @@ import (
 	oci "github.com/containers/virtcontainers/pkg/oci"
 )
 
-const formatOptions = `table or json`
+const formatOptions = `table, json or a Go template (for example '{{.ID}} {{.Status}}')`
+
+const (
+	// filterStatus, filterAnnotation and filterPod are the keys of the
+	// list filters, selecting containers by status, by annotation
+	// ("name=value", or just "name" to select containers with the
+	// annotation whatever its value) and by pod ID respectively.
+	filterStatus     = "status"
+	filterAnnotation = "annotation"
+	filterPod        = "pod"
+
+	// defaultWatchInterval is the default interval between two refreshes
+	// of the list in watch mode.
+	defaultWatchInterval = time.Second
+
+	// clearScreen moves the cursor to the top left of the terminal and
+	// clears it.
+	clearScreen = "\033[H\033[2J"
+)
+
+// sortKeys maps the keys list can sort containers by to the
+// corresponding comparison functions.
+var sortKeys = map[string]func(a, b fullContainerState) bool{
+	"id":      func(a, b fullContainerState) bool { return a.ID < b.ID },
+	"pid":     func(a, b fullContainerState) bool { return a.InitProcessPid < b.InitProcessPid },
+	"status":  func(a, b fullContainerState) bool { return a.Status < b.Status },
+	"bundle":  func(a, b fullContainerState) bool { return a.Bundle < b.Bundle },
+	"created": func(a, b fullContainerState) bool { return a.Created.Before(b.Created) },
+	"owner":   func(a, b fullContainerState) bool { return a.Owner < b.Owner },
+	"pod":     func(a, b fullContainerState) bool { return a.PodID < b.PodID },
+}
+
+const (
+	// sandboxTypeName and containerTypeName are the container types
+	// displayed for the container that created a pod and the other
+	// containers of the pod respectively.
+	sandboxTypeName   = "sandbox"
+	containerTypeName = "container"
+)
 
 // containerState represents the platform agnostic pieces relating to a
 // running container's status and state
@@ -63,21 +109,48 @@ type hypervisorDetails struct {
 	KernelPath     string `json:"kernelPath"`
 }
 
-// fullContainerState specifies the core state plus the hypervisor
-// details
+// podDetails stores details of the pod, and of the VM hosting it, the
+// container belongs to
+type podDetails struct {
+	PodID string `json:"id"`
+	// Type is either "sandbox" or "container"
+	Type string `json:"containerType"`
+	// VCPUs is the number of virtual CPUs of the VM
+	VCPUs uint32 `json:"vcpus"`
+	// Memory is the amount of memory of the VM in MiB
+	Memory uint32 `json:"memory"`
+	// HypervisorPid is the PID of the hypervisor running the VM, or 0
+	// if the VM is not running
+	HypervisorPid int `json:"hypervisorPid"`
+}
+
+// fullContainerState specifies the core state plus the pod and
+// hypervisor details
 type fullContainerState struct {
 	containerState
+	podDetails        `json:"pod"`
 	hypervisorDetails `json:"hypervisor"`
 }
 
+// containerFilters selects the containers displayed by list. It maps
+// each filter key to the accepted values: a container is selected if
+// it matches at least one of the values of every key.
+type containerFilters map[string][]string
+
 type formatState interface {
-	Write(state []fullContainerState, showAll bool, file *os.File) error
+	Write(state []fullContainerState, showAll bool, file io.Writer) error
 }
 
 type formatJSON struct{}
 type formatIDList struct{}
 type formatTabular struct{}
 
+// formatTemplate displays each container by applying a Go template to
+// its fullContainerState.
+type formatTemplate struct {
+	tmpl *template.Template
+}
+
 var listCLICommand = cli.Command{
 	Name:  "list",
 	Usage: "lists containers started by " + name + " with the given root",
@@ -92,7 +165,17 @@ To list containers created via the default "--root":
 
 EXAMPLE 2:
 To list containers created using a non-default value for "--root":
-       # ` + name + ` --root value list`,
+       # ` + name + ` --root value list
+
+EXAMPLE 3:
+To list the ID and pod ID of each container:
+       # ` + name + ` list --format '{{.ID}} {{.PodID}}'
+
+EXAMPLE 4:
+To watch the running sandbox containers, sorted by creation time:
+       # ` + name + ` list --watch --sort created \
+           --filter status=running \
+           --filter annotation=io.kubernetes.cri-o.ContainerType=sandbox`,
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "format, f",
@@ -107,34 +190,282 @@ To list containers created using a non-default value for "--root":
 			Name:  "cc-all",
 			Usage: "display all available " + project + " information",
 		},
+		cli.StringSliceFlag{
+			Name:  "filter",
+			Usage: "display only the containers matching the filter (" + filterStatus + "=STATUS, " + filterAnnotation + "=NAME[=VALUE] or " + filterPod + "=POD-ID), may be repeated",
+		},
+		cli.StringFlag{
+			Name:  "sort",
+			Usage: "sort containers by one of: id, pid, status, bundle, created, owner or pod",
+		},
+		cli.BoolFlag{
+			Name:  "watch, w",
+			Usage: "redisplay the list whenever it changes until interrupted",
+		},
+		cli.DurationFlag{
+			Name:  "interval",
+			Value: defaultWatchInterval,
+			Usage: "interval between two refreshes of the list in watch mode",
+		},
 	},
 	Action: func(context *cli.Context) error {
-		s, err := getContainers(context)
+		f, err := listFormatter(context)
+		if err != nil {
+			return err
+		}
+
+		filters, err := parseFilters(context.StringSlice("filter"))
 		if err != nil {
 			return err
 		}
 
-		file := os.Stdout
+		sortKey := context.String("sort")
+		if _, ok := sortKeys[sortKey]; sortKey != "" && !ok {
+			return fmt.Errorf("invalid sort key %q", sortKey)
+		}
+
+		list := func() ([]fullContainerState, error) {
+			s, err := getContainers(context)
+			if err != nil {
+				return nil, err
+			}
+
+			s = filterContainers(s, filters)
+			sortContainers(s, sortKey)
+
+			return s, nil
+		}
+
 		showAll := context.Bool("cc-all")
 
-		if context.Bool("quiet") {
-			return (&formatIDList{}).Write(s, showAll, file)
+		if context.Bool("watch") {
+			interval := context.Duration("interval")
+			if interval <= 0 {
+				return fmt.Errorf("invalid watch interval %v", interval)
+			}
+
+			done := make(chan struct{})
+
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+			defer signal.Stop(sigCh)
+
+			go func() {
+				<-sigCh
+				close(done)
+			}()
+
+			return watchContainers(list, f, showAll, interval, os.Stdout, isTerminal(os.Stdout.Fd()), done)
+		}
+
+		s, err := list()
+		if err != nil {
+			return err
 		}
 
-		switch context.String("format") {
-		case "table":
-			return (&formatTabular{}).Write(s, showAll, file)
+		return f.Write(s, showAll, os.Stdout)
+	},
+}
+
+// listFormatter returns the formatter selected by the list options.
+func listFormatter(context *cli.Context) (formatState, error) {
+	if context.Bool("quiet") {
+		return &formatIDList{}, nil
+	}
+
+	switch context.String("format") {
+	case "table":
+		return &formatTabular{}, nil
+
+	case "json":
+		return &formatJSON{}, nil
+
+	default:
+		return newFormatTemplate(context.String("format"))
+	}
+}
+
+// parseFilters parses the list filters, which are of the form
+// "key=value".
+func parseFilters(args []string) (containerFilters, error) {
+	filters := make(containerFilters)
+
+	for _, arg := range args {
+		fields := strings.SplitN(arg, "=", 2)
+		if len(fields) != 2 || fields[1] == "" {
+			return nil, fmt.Errorf("invalid filter %q: expected key=value", arg)
+		}
 
-		case "json":
-			return (&formatJSON{}).Write(s, showAll, file)
+		key, value := fields[0], fields[1]
 
+		switch key {
+		case filterStatus, filterAnnotation, filterPod:
 		default:
-			return fmt.Errorf("invalid format option")
+			return nil, fmt.Errorf("invalid filter key %q (expected %s, %s or %s)",
+				key, filterStatus, filterAnnotation, filterPod)
 		}
-	},
+
+		filters[key] = append(filters[key], value)
+	}
+
+	return filters, nil
+}
+
+// matchAnnotation returns true if the annotations match the annotation
+// filter value, either "name=value" or "name".
+func matchAnnotation(annotations map[string]string, filter string) bool {
+	fields := strings.SplitN(filter, "=", 2)
+
+	value, ok := annotations[fields[0]]
+	if !ok {
+		return false
+	}
+
+	return len(fields) == 1 || value == fields[1]
+}
+
+// match returns true if the container is selected by the filters.
+func (filters containerFilters) match(state fullContainerState) bool {
+	for key, values := range filters {
+		matched := false
+
+		for _, value := range values {
+			switch key {
+			case filterStatus:
+				matched = state.Status == value
+			case filterAnnotation:
+				matched = matchAnnotation(state.Annotations, value)
+			case filterPod:
+				matched = state.PodID == value
+			}
+
+			if matched {
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
 }
 
-func (f *formatIDList) Write(state []fullContainerState, showAll bool, file *os.File) error {
+// filterContainers returns the containers selected by the filters.
+func filterContainers(state []fullContainerState, filters containerFilters) []fullContainerState {
+	if len(filters) == 0 {
+		return state
+	}
+
+	var selected []fullContainerState
+
+	for _, item := range state {
+		if filters.match(item) {
+			selected = append(selected, item)
+		}
+	}
+
+	return selected
+}
+
+// sortContainers sorts the containers by the specified key (see
+// sortKeys), preserving the order of containers with equal keys. The
+// order is left unchanged if the key is empty.
+func sortContainers(state []fullContainerState, key string) {
+	less, ok := sortKeys[key]
+	if !ok {
+		return
+	}
+
+	sort.Stable(containersBy{state, less})
+}
+
+// containersBy sorts containers using the comparison function less.
+type containersBy struct {
+	state []fullContainerState
+	less  func(a, b fullContainerState) bool
+}
+
+func (c containersBy) Len() int           { return len(c.state) }
+func (c containersBy) Swap(i, j int)      { c.state[i], c.state[j] = c.state[j], c.state[i] }
+func (c containersBy) Less(i, j int) bool { return c.less(c.state[i], c.state[j]) }
+
+// watchContainers displays the containers returned by list every
+// interval until done is closed, redrawing the display only if it has
+// changed. The screen is cleared before each redraw if clear is true.
+//
+// Each refresh involves a single scan of the pods.
+func watchContainers(list func() ([]fullContainerState, error), f formatState, showAll bool,
+	interval time.Duration, out io.Writer, clear bool, done <-chan struct{}) error {
+	var last []byte
+	drawn := false
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s, err := list()
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+
+		if err := f.Write(s, showAll, &buf); err != nil {
+			return err
+		}
+
+		if !drawn || !bytes.Equal(buf.Bytes(), last) {
+			if clear {
+				fmt.Fprint(out, clearScreen)
+			}
+
+			if _, err := out.Write(buf.Bytes()); err != nil {
+				return err
+			}
+
+			last = buf.Bytes()
+			drawn = true
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// newFormatTemplate returns a formatter for the specified Go template.
+func newFormatTemplate(format string) (*formatTemplate, error) {
+	if !strings.Contains(format, "{{") {
+		return nil, fmt.Errorf("invalid format option")
+	}
+
+	tmpl, err := template.New("list").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format template: %v", err)
+	}
+
+	return &formatTemplate{tmpl: tmpl}, nil
+}
+
+func (f *formatTemplate) Write(state []fullContainerState, showAll bool, file io.Writer) error {
+	for _, item := range state {
+		if err := f.tmpl.Execute(file, item); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintln(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *formatIDList) Write(state []fullContainerState, showAll bool, file io.Writer) error {
 	for _, item := range state {
 		_, err := fmt.Fprintln(file, item.ID)
 		if err != nil {
@@ -144,7 +475,7 @@ func (f *formatIDList) Write(state []fullContainerState, showAll bool, file *os.
 
 	return nil
 }
-func (f *formatTabular) Write(state []fullContainerState, showAll bool, file *os.File) error {
+func (f *formatTabular) Write(state []fullContainerState, showAll bool, file io.Writer) error {
 	// values used by runc
 	flags := uint(0)
 	minWidth := 12
@@ -156,7 +487,7 @@ func (f *formatTabular) Write(state []fullContainerState, showAll bool, file *os
 	fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER")
 
 	if showAll {
-		fmt.Fprint(w, "\tHYPERVISOR\tKERNEL\tIMAGE\n")
+		fmt.Fprint(w, "\tPOD\tTYPE\tVCPUS\tMEMORY\tVM PID\tHYPERVISOR\tKERNEL\tIMAGE\n")
 	} else {
 		fmt.Fprintf(w, "\n")
 	}
@@ -171,7 +502,12 @@ func (f *formatTabular) Write(state []fullContainerState, showAll bool, file *os
 			item.Owner)
 
 		if showAll {
-			fmt.Fprintf(w, "\t%s\t%s\t%s\n",
+			fmt.Fprintf(w, "\t%s\t%s\t%d\t%dMiB\t%d\t%s\t%s\t%s\n",
+				item.PodID,
+				item.Type,
+				item.VCPUs,
+				item.Memory,
+				item.HypervisorPid,
 				item.HypervisorPath,
 				item.KernelPath,
 				item.ImagePath)
@@ -185,7 +521,7 @@ func (f *formatTabular) Write(state []fullContainerState, showAll bool, file *os
 	return nil
 }
 
-func (f *formatJSON) Write(state []fullContainerState, showAll bool, file *os.File) error {
+func (f *formatJSON) Write(state []fullContainerState, showAll bool, file io.Writer) error {
 	return json.NewEncoder(file).Encode(state)
 }
 
@@ -213,12 +549,21 @@ func getContainers(context *cli.Context) ([]fullContainerState, error) {
 			continue
 		}
 
+		vcpus, memory := podResources(pod)
+
 		for _, container := range pod.ContainersStatus {
 			ociState, err := oci.StatusToOCIState(container)
 			if err != nil {
 				return nil, err
 			}
 
+			owner, err := containerOwner(vc.ContainerStatePath(pod.ID, container.ID))
+			if err != nil {
+				// the container may have been deleted since the pods
+				// were listed
+				ccLog.Warnf("Cannot determine owner of container %s: %v", container.ID, err)
+			}
+
 			s = append(s, fullContainerState{
 				containerState: containerState{
 					Version:        ociState.Version,
@@ -229,8 +574,14 @@ func getContainers(context *cli.Context) ([]fullContainerState, error) {
 					Rootfs:         container.RootFs,
 					Created:        container.StartTime,
 					Annotations:    ociState.Annotations,
-
-					// FIXME: Owner,
+					Owner:          owner,
+				},
+				podDetails: podDetails{
+					PodID:         pod.ID,
+					Type:          displayContainerType(container.Annotations),
+					VCPUs:         vcpus,
+					Memory:        memory,
+					HypervisorPid: pod.HypervisorPID,
 				},
 				hypervisorDetails: hypervisorDetails,
 			})
@@ -240,6 +591,55 @@ func getContainers(context *cli.Context) ([]fullContainerState, error) {
 	return s, nil
 }
 
+// containerOwner returns the name of the user owning the specified
+// container state directory, or "#UID" if the user has no name.
+func containerOwner(stateDir string) (string, error) {
+	st, err := os.Stat(stateDir)
+	if err != nil {
+		return "", err
+	}
+
+	uid := st.Sys().(*syscall.Stat_t).Uid
+
+	u, err := user.LookupId(fmt.Sprintf("%d", uid))
+	if err != nil {
+		return fmt.Sprintf("#%d", uid), nil
+	}
+
+	return u.Username, nil
+}
+
+// displayContainerType returns the type of the container with the
+// specified annotations as displayed by list.
+func displayContainerType(annotations map[string]string) string {
+	cType, err := oci.GetContainerType(annotations)
+	if err != nil {
+		return ""
+	}
+
+	if cType.IsPod() {
+		return sandboxTypeName
+	}
+
+	return containerTypeName
+}
+
+// podResources returns the number of vCPUs and the memory size (in
+// MiB) of the VM of the specified pod.
+func podResources(pod vc.PodStatus) (vcpus, memory uint32) {
+	vcpus = pod.HypervisorConfig.DefaultVCPUs
+	if pod.VMConfig.VCPUs > 0 {
+		vcpus = uint32(pod.VMConfig.VCPUs)
+	}
+
+	memory = pod.HypervisorConfig.DefaultMemSz
+	if pod.VMConfig.Memory > 0 {
+		memory = uint32(pod.VMConfig.Memory)
+	}
+
+	return vcpus, memory
+}
+
 // getHypervisorDetails returns details of the hypervisor used to host
 // the container.
 //
@@ -15,11 +15,15 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/user"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"syscall"
@@ -48,6 +52,13 @@ var testStatuses = []fullContainerState{
 			Annotations:    map[string]string(nil),
 			Owner:          "",
 		},
+		podDetails: podDetails{
+			PodID:         "1",
+			Type:          "sandbox",
+			VCPUs:         2,
+			Memory:        2048,
+			HypervisorPid: 4321,
+		},
 		hypervisorDetails: hypervisorDetails{
 			HypervisorPath: "/hypervisor/path",
 			ImagePath:      "/image/path",
@@ -65,6 +76,13 @@ var testStatuses = []fullContainerState{
 			Annotations:    map[string]string(nil),
 			Owner:          "",
 		},
+		podDetails: podDetails{
+			PodID:         "1",
+			Type:          "container",
+			VCPUs:         2,
+			Memory:        2048,
+			HypervisorPid: 4321,
+		},
 		hypervisorDetails: hypervisorDetails{
 			HypervisorPath: "/hypervisor/path2",
 			ImagePath:      "/image/path2",
@@ -82,6 +100,13 @@ var testStatuses = []fullContainerState{
 			Annotations:    map[string]string(nil),
 			Owner:          "",
 		},
+		podDetails: podDetails{
+			PodID:         "3",
+			Type:          "sandbox",
+			VCPUs:         1,
+			Memory:        1024,
+			HypervisorPid: 0,
+		},
 		hypervisorDetails: hypervisorDetails{
 			HypervisorPath: "/hypervisor/path3",
 			ImagePath:      "/image/path3",
@@ -240,7 +265,7 @@ func TestStateToTabular(t *testing.T) {
 	expectedLength := len(testStatuses) + 1
 
 	expectedDefaultHeaderPattern := `\AID\s+PID\s+STATUS\s+BUNDLE\s+CREATED\s+OWNER`
-	expectedExtendedHeaderPattern := `HYPERVISOR\s+KERNEL\s+IMAGE`
+	expectedExtendedHeaderPattern := `POD\s+TYPE\s+VCPUS\s+MEMORY\s+VM PID\s+HYPERVISOR\s+KERNEL\s+IMAGE`
 	endingPattern := `\s*\z`
 
 	lines, err := formatListDataAsString(&formatTabular{}, testStatuses, false)
@@ -322,13 +347,18 @@ func TestStateToTabular(t *testing.T) {
 		lineIndex := i + 1
 		line := lines[lineIndex]
 
-		expectedLinePattern := fmt.Sprintf(`\A%s\s+%d\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s*\z`,
+		expectedLinePattern := fmt.Sprintf(`\A%s\s+%d\s+%s\s+%s\s+%s\s+%s\s+%s\s+%s\s+%d\s+%dMiB\s+%d\s+%s\s+%s\s+%s\s*\z`,
 			regexp.QuoteMeta(status.ID),
 			status.InitProcessPid,
 			regexp.QuoteMeta(status.Status),
 			regexp.QuoteMeta(status.Bundle),
 			regexp.QuoteMeta(status.Created.Format(time.RFC3339Nano)),
 			regexp.QuoteMeta(status.Owner),
+			regexp.QuoteMeta(status.PodID),
+			regexp.QuoteMeta(status.Type),
+			status.VCPUs,
+			status.Memory,
+			status.HypervisorPid,
 			regexp.QuoteMeta(status.hypervisorDetails.HypervisorPath),
 			regexp.QuoteMeta(status.hypervisorDetails.KernelPath),
 			regexp.QuoteMeta(status.hypervisorDetails.ImagePath))
@@ -396,3 +426,274 @@ func TestStateToJSON(t *testing.T) {
 		assert.Equal(t, states, testStatuses, "states + testStatuses")
 	}
 }
+
+func TestStateToTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newFormatTemplate("yaml")
+	assert.Error(err)
+
+	_, err = newFormatTemplate("{{.ID")
+	assert.Error(err)
+
+	_, err = newFormatTemplate("{{.NoSuchField}}")
+	assert.NoError(err)
+
+	f, err := newFormatTemplate("{{.ID}} {{.Status}} {{.PodID}} {{.Type}} {{.VCPUs}} {{.HypervisorPath}}")
+	assert.NoError(err)
+
+	// showAll should not affect the output
+	for _, showAll := range []bool{true, false} {
+		lines, err := formatListDataAsString(f, testStatuses, showAll)
+		assert.NoError(err)
+
+		var expected []string
+		for _, s := range testStatuses {
+			expected = append(expected, fmt.Sprintf("%s %s %s %s %d %s",
+				s.ID, s.Status, s.PodID, s.Type, s.VCPUs, s.HypervisorPath))
+		}
+
+		assert.Equal(expected, lines)
+	}
+
+	f, err = newFormatTemplate("{{.NoSuchField}}")
+	assert.NoError(err)
+
+	_, err = formatListDataAsString(f, testStatuses, false)
+	assert.Error(err)
+}
+
+func TestContainerOwner(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpDir, err := ioutil.TempDir(testDir, "owner-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	_, err = containerOwner(filepath.Join(tmpDir, "does-not-exist"))
+	assert.Error(err)
+
+	owner, err := containerOwner(tmpDir)
+	assert.NoError(err)
+
+	u, err := user.Current()
+	assert.NoError(err)
+	assert.Equal(u.Username, owner)
+}
+
+func TestDisplayContainerType(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", displayContainerType(nil))
+
+	assert.Equal(sandboxTypeName, displayContainerType(map[string]string{
+		oci.ContainerTypeKey: string(vc.PodSandbox),
+	}))
+
+	assert.Equal(containerTypeName, displayContainerType(map[string]string{
+		oci.ContainerTypeKey: string(vc.PodContainer),
+	}))
+}
+
+func TestPodResources(t *testing.T) {
+	assert := assert.New(t)
+
+	pod := vc.PodStatus{
+		HypervisorConfig: vc.HypervisorConfig{
+			DefaultVCPUs: 1,
+			DefaultMemSz: 2048,
+		},
+	}
+
+	vcpus, memory := podResources(pod)
+	assert.Equal(uint32(1), vcpus)
+	assert.Equal(uint32(2048), memory)
+
+	pod.VMConfig = vc.Resources{VCPUs: 4, Memory: 512}
+
+	vcpus, memory = podResources(pod)
+	assert.Equal(uint32(4), vcpus)
+	assert.Equal(uint32(512), memory)
+}
+
+func TestParseFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, args := range [][]string{
+		{"status"},
+		{"status="},
+		{"=running"},
+		{"foo=bar"},
+		{"status=running", "owner=root"},
+	} {
+		_, err := parseFilters(args)
+		assert.Error(err, "%v", args)
+	}
+
+	filters, err := parseFilters(nil)
+	assert.NoError(err)
+	assert.Empty(filters)
+
+	filters, err = parseFilters([]string{
+		"status=running",
+		"status=paused",
+		"annotation=foo=bar=baz",
+		"pod=1",
+	})
+	assert.NoError(err)
+	assert.Equal(containerFilters{
+		filterStatus:     {"running", "paused"},
+		filterAnnotation: {"foo=bar=baz"},
+		filterPod:        {"1"},
+	}, filters)
+}
+
+func TestFilterContainers(t *testing.T) {
+	assert := assert.New(t)
+
+	state := []fullContainerState{
+		{
+			containerState: containerState{
+				ID:          "1",
+				Status:      "running",
+				Annotations: map[string]string{"type": "sandbox", "foo": "bar"},
+			},
+			podDetails: podDetails{PodID: "1"},
+		},
+		{
+			containerState: containerState{
+				ID:          "2",
+				Status:      "stopped",
+				Annotations: map[string]string{"type": "container"},
+			},
+			podDetails: podDetails{PodID: "1"},
+		},
+		{
+			containerState: containerState{
+				ID:          "3",
+				Status:      "running",
+				Annotations: map[string]string{"type": "sandbox"},
+			},
+			podDetails: podDetails{PodID: "3"},
+		},
+	}
+
+	type testData struct {
+		filters  []string
+		expected []string
+	}
+
+	data := []testData{
+		{nil, []string{"1", "2", "3"}},
+		{[]string{"status=running"}, []string{"1", "3"}},
+		{[]string{"status=running", "status=stopped"}, []string{"1", "2", "3"}},
+		{[]string{"status=paused"}, nil},
+		{[]string{"pod=1"}, []string{"1", "2"}},
+		{[]string{"pod=1", "status=running"}, []string{"1"}},
+		{[]string{"annotation=type=sandbox"}, []string{"1", "3"}},
+		{[]string{"annotation=foo"}, []string{"1"}},
+		{[]string{"annotation=foo=baz"}, nil},
+		{[]string{"annotation=type=sandbox", "pod=3"}, []string{"3"}},
+	}
+
+	for _, d := range data {
+		filters, err := parseFilters(d.filters)
+		assert.NoError(err)
+
+		var ids []string
+		for _, s := range filterContainers(state, filters) {
+			ids = append(ids, s.ID)
+		}
+
+		assert.Equal(d.expected, ids, "filters %v", d.filters)
+	}
+}
+
+func TestSortContainers(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+
+	state := []fullContainerState{
+		{
+			containerState: containerState{ID: "b", InitProcessPid: 3, Created: now},
+			podDetails:     podDetails{PodID: "2"},
+		},
+		{
+			containerState: containerState{ID: "c", InitProcessPid: 1, Created: now.Add(-time.Hour)},
+			podDetails:     podDetails{PodID: "1"},
+		},
+		{
+			containerState: containerState{ID: "a", InitProcessPid: 2, Created: now.Add(time.Hour)},
+			podDetails:     podDetails{PodID: "2"},
+		},
+	}
+
+	type testData struct {
+		key      string
+		expected []string
+	}
+
+	data := []testData{
+		{"", []string{"b", "c", "a"}},
+		{"id", []string{"a", "b", "c"}},
+		{"pid", []string{"c", "a", "b"}},
+		{"created", []string{"c", "b", "a"}},
+		// stable sort
+		{"pod", []string{"c", "b", "a"}},
+	}
+
+	for _, d := range data {
+		s := make([]fullContainerState, len(state))
+		copy(s, state)
+
+		sortContainers(s, d.key)
+
+		var ids []string
+		for _, item := range s {
+			ids = append(ids, item.ID)
+		}
+
+		assert.Equal(d.expected, ids, "key %q", d.key)
+	}
+}
+
+func TestWatchContainers(t *testing.T) {
+	assert := assert.New(t)
+
+	done := make(chan struct{})
+	calls := 0
+
+	// The list changes on the third refresh only, and watching stops
+	// on the fifth.
+	list := func() ([]fullContainerState, error) {
+		calls++
+
+		switch calls {
+		case 3, 4, 5:
+			if calls == 5 {
+				close(done)
+			}
+			return testStatuses[:1], nil
+		default:
+			return testStatuses, nil
+		}
+	}
+
+	var out bytes.Buffer
+
+	err := watchContainers(list, &formatIDList{}, false, time.Millisecond, &out, true, done)
+	assert.NoError(err)
+	assert.Equal(5, calls)
+
+	expected := clearScreen + "1\n2\n3\n" + clearScreen + "1\n"
+	assert.Equal(expected, out.String())
+
+	listErr := errors.New("list failed")
+	list = func() ([]fullContainerState, error) {
+		return nil, listErr
+	}
+
+	err = watchContainers(list, &formatIDList{}, false, time.Millisecond, &out, false, make(chan struct{}))
+	assert.Equal(listErr, err)
+}
@@ -0,0 +1,309 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Supported values for the log_backend option in the [runtime] table
+// of the configuration file.
+const (
+	// fileLogBackend sends the persistent runtime log to the global
+	// log file (see GlobalLogHook).
+	fileLogBackend = "file"
+
+	// syslogLogBackend sends the persistent runtime log to the local
+	// syslog daemon.
+	syslogLogBackend = "syslog"
+
+	// journaldLogBackend sends the persistent runtime log to the
+	// systemd journal using its native protocol.
+	journaldLogBackend = "journald"
+)
+
+// journalFieldMaxLen is the maximum length of a journal field name.
+const journalFieldMaxLen = 64
+
+// variables to allow tests to modify the values
+var (
+	// syslogSocketPath is the local syslog socket.
+	syslogSocketPath = "/dev/log"
+
+	// journalSocketPath is the socket the systemd journal listens on
+	// for native protocol messages.
+	journalSocketPath = "/run/systemd/journal/socket"
+)
+
+var errNeedLogSocketPath = errors.New("Log socket path cannot be empty")
+
+// SyslogHook is a logrus hook that sends all log entries to the local
+// syslog daemon.
+type SyslogHook struct {
+	path   string
+	writer *syslog.Writer
+}
+
+// JournalHook is a logrus hook that sends all log entries to the
+// systemd journal. Any fields attached to a log entry are sent as
+// structured journal fields.
+type JournalHook struct {
+	path string
+	conn *net.UnixConn
+}
+
+// handleLogBackend sets up the persistent log for the backend
+// specified.
+func handleLogBackend(backend, logfilePath string, rotation logRotation) error {
+	var hook logrus.Hook
+	var err error
+
+	switch backend {
+	case fileLogBackend:
+		return handleGlobalLog(logfilePath, rotation)
+	case syslogLogBackend:
+		hook, err = newSyslogHook(syslogSocketPath)
+	case journaldLogBackend:
+		hook, err = newJournalHook(journalSocketPath)
+	default:
+		return fmt.Errorf("unknown log backend %q", backend)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ccLog.Hooks.Add(hook)
+
+	return nil
+}
+
+// newSyslogHook creates a new hook that sends log entries to the
+// syslog socket specified.
+func newSyslogHook(socketPath string) (*SyslogHook, error) {
+	if socketPath == "" {
+		return nil, errNeedLogSocketPath
+	}
+
+	w, err := syslog.Dial("unixgram", socketPath, syslog.LOG_INFO|syslog.LOG_DAEMON, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SyslogHook{
+		path:   socketPath,
+		writer: w,
+	}, nil
+}
+
+// Levels informs the logrus Logger which log levels this hook supports.
+func (hook *SyslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire is called by the logrus logger when data is available for the
+// hook.
+func (hook *SyslogHook) Fire(entry *logrus.Entry) error {
+	msg := entry.Message
+
+	if fields := formatLogFields(entry.Data); fields != "" {
+		msg = fmt.Sprintf("%s %s", msg, fields)
+	}
+
+	switch entry.Level {
+	case logrus.PanicLevel:
+		return hook.writer.Emerg(msg)
+	case logrus.FatalLevel:
+		return hook.writer.Crit(msg)
+	case logrus.ErrorLevel:
+		return hook.writer.Err(msg)
+	case logrus.WarnLevel:
+		return hook.writer.Warning(msg)
+	case logrus.InfoLevel:
+		return hook.writer.Info(msg)
+	default:
+		return hook.writer.Debug(msg)
+	}
+}
+
+// newJournalHook creates a new hook that sends log entries to the
+// journal socket specified.
+func newJournalHook(socketPath string) (*JournalHook, error) {
+	if socketPath == "" {
+		return nil, errNeedLogSocketPath
+	}
+
+	addr := &net.UnixAddr{
+		Name: socketPath,
+		Net:  "unixgram",
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JournalHook{
+		path: socketPath,
+		conn: conn,
+	}, nil
+}
+
+// Levels informs the logrus Logger which log levels this hook supports.
+func (hook *JournalHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire is called by the logrus logger when data is available for the
+// hook.
+func (hook *JournalHook) Fire(entry *logrus.Entry) error {
+	fields := map[string]string{
+		"MESSAGE":           entry.Message,
+		"PRIORITY":          fmt.Sprintf("%d", journalPriority(entry.Level)),
+		"SYSLOG_IDENTIFIER": name,
+		"SYSLOG_PID":        fmt.Sprintf("%d", os.Getpid()),
+	}
+
+	for k, v := range entry.Data {
+		key := journalFieldName(k)
+		if key == "" {
+			continue
+		}
+
+		// Don't allow user fields to replace the standard ones.
+		if _, exists := fields[key]; exists {
+			continue
+		}
+
+		fields[key] = fmt.Sprintf("%v", v)
+	}
+
+	_, err := hook.conn.Write(journalMessage(fields))
+
+	return err
+}
+
+// journalPriority converts a logrus level into a syslog(3) priority
+// value as expected by the journal.
+func journalPriority(level logrus.Level) syslog.Priority {
+	switch level {
+	case logrus.PanicLevel:
+		return syslog.LOG_EMERG
+	case logrus.FatalLevel:
+		return syslog.LOG_CRIT
+	case logrus.ErrorLevel:
+		return syslog.LOG_ERR
+	case logrus.WarnLevel:
+		return syslog.LOG_WARNING
+	case logrus.InfoLevel:
+		return syslog.LOG_INFO
+	default:
+		return syslog.LOG_DEBUG
+	}
+}
+
+// journalFieldName converts the specified logrus field name into a
+// valid journal field name. Journal field names may only contain
+// uppercase letters, digits and underscores and must not start with
+// an underscore (such fields are reserved for the journal itself).
+//
+// An empty string is returned if no valid name can be derived.
+func journalFieldName(key string) string {
+	var b bytes.Buffer
+
+	for _, r := range strings.ToUpper(key) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+
+	field := strings.TrimLeft(b.String(), "_")
+
+	if field == "" {
+		return ""
+	}
+
+	// Field names must not start with a digit
+	if field[0] >= '0' && field[0] <= '9' {
+		return ""
+	}
+
+	if len(field) > journalFieldMaxLen {
+		field = field[:journalFieldMaxLen]
+	}
+
+	return field
+}
+
+// journalMessage encodes the specified fields using the journal
+// native protocol.
+//
+// See https://www.freedesktop.org/wiki/Software/systemd/export/
+func journalMessage(fields map[string]string) []byte {
+	var b bytes.Buffer
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := fields[k]
+
+		if !strings.Contains(v, "\n") {
+			fmt.Fprintf(&b, "%s=%s\n", k, v)
+			continue
+		}
+
+		// Values containing newlines must be sent in binary
+		// form: the field name, a newline, the size of the
+		// value as a little-endian 64-bit integer, the value
+		// itself and a final newline.
+		b.WriteString(k)
+		b.WriteByte('\n')
+		binary.Write(&b, binary.LittleEndian, uint64(len(v)))
+		b.WriteString(v)
+		b.WriteByte('\n')
+	}
+
+	return b.Bytes()
+}
+
+// formatLogFields returns the specified fields as a string of
+// space-separated "name=value" pairs, sorted by name.
+func formatLogFields(data logrus.Fields) string {
+	var pairs []string
+
+	for k, v := range data {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, " ")
+}
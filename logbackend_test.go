@@ -0,0 +1,243 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestLogListener creates a datagram socket that can be used as a
+// stand-in for the syslog and journal sockets.
+func newTestLogListener(t *testing.T, dir, name string) (*net.UnixConn, string) {
+	path := filepath.Join(dir, name)
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, path
+}
+
+func readTestLogMessage(t *testing.T, conn *net.UnixConn) []byte {
+	buf := make([]byte, 64*1024)
+
+	err := conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	assert.NoError(t, err)
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf[:n]
+}
+
+func TestJournalFieldName(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []struct {
+		key      string
+		expected string
+	}{
+		{"", ""},
+		{"_", ""},
+		{"9lives", ""},
+		{"container", "CONTAINER"},
+		{"container-id", "CONTAINER_ID"},
+		{"_private", "PRIVATE"},
+		{"pod.id", "POD_ID"},
+		{strings.Repeat("a", journalFieldMaxLen+10), strings.Repeat("A", journalFieldMaxLen)},
+	}
+
+	for _, d := range data {
+		assert.Equal(d.expected, journalFieldName(d.key), "key %q", d.key)
+	}
+}
+
+func TestJournalMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := journalMessage(map[string]string{
+		"MESSAGE":   "hello",
+		"CONTAINER": "foo",
+	})
+
+	assert.Equal("CONTAINER=foo\nMESSAGE=hello\n", string(msg))
+
+	value := "multi\nline"
+	msg = journalMessage(map[string]string{
+		"MESSAGE": value,
+	})
+
+	var expected bytes.Buffer
+	expected.WriteString("MESSAGE\n")
+	binary.Write(&expected, binary.LittleEndian, uint64(len(value)))
+	expected.WriteString(value + "\n")
+
+	assert.Equal(expected.Bytes(), msg)
+}
+
+func TestNewLogBackendHooksNeedPath(t *testing.T) {
+	_, err := newSyslogHook("")
+	assert.Error(t, err)
+
+	_, err = newJournalHook("")
+	assert.Error(t, err)
+
+	_, err = newJournalHook("/this/socket/does/not/exist")
+	assert.Error(t, err)
+}
+
+func TestJournalHookFire(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "journal-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	listener, path := newTestLogListener(t, tmpdir, "socket")
+	defer listener.Close()
+
+	hook, err := newJournalHook(path)
+	assert.NoError(err)
+
+	entry := &logrus.Entry{
+		Logger:  ccLog,
+		Time:    time.Now().UTC(),
+		Level:   logrus.WarnLevel,
+		Message: "foo bar",
+		Data: logrus.Fields{
+			"container": "abc123",
+			"MESSAGE":   "should not override",
+		},
+	}
+
+	err = hook.Fire(entry)
+	assert.NoError(err)
+
+	msg := string(readTestLogMessage(t, listener))
+
+	for _, field := range []string{
+		"MESSAGE=foo bar\n",
+		"CONTAINER=abc123\n",
+		"PRIORITY=4\n",
+		fmt.Sprintf("SYSLOG_IDENTIFIER=%s\n", name),
+		fmt.Sprintf("SYSLOG_PID=%d\n", os.Getpid()),
+	} {
+		assert.Contains(msg, field)
+	}
+
+	assert.NotContains(msg, "should not override")
+}
+
+func TestSyslogHookFire(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "syslog-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	listener, path := newTestLogListener(t, tmpdir, "socket")
+	defer listener.Close()
+
+	hook, err := newSyslogHook(path)
+	assert.NoError(err)
+
+	entry := &logrus.Entry{
+		Logger:  ccLog,
+		Time:    time.Now().UTC(),
+		Level:   logrus.ErrorLevel,
+		Message: "something failed",
+		Data: logrus.Fields{
+			"container": "abc123",
+		},
+	}
+
+	err = hook.Fire(entry)
+	assert.NoError(err)
+
+	msg := string(readTestLogMessage(t, listener))
+
+	// LOG_DAEMON|LOG_ERR
+	assert.True(strings.HasPrefix(msg, "<27>"), "unexpected priority in %q", msg)
+	assert.Contains(msg, fmt.Sprintf("%s[%d]", name, os.Getpid()))
+	assert.Contains(msg, "something failed container=abc123")
+}
+
+func TestHandleLogBackend(t *testing.T) {
+	assert := assert.New(t)
+
+	savedHooks := ccLog.Hooks
+	savedSyslogSocketPath := syslogSocketPath
+	savedJournalSocketPath := journalSocketPath
+
+	defer func() {
+		ccLog.Hooks = savedHooks
+		syslogSocketPath = savedSyslogSocketPath
+		journalSocketPath = savedJournalSocketPath
+	}()
+
+	tmpdir, err := ioutil.TempDir(testDir, "log-backend-")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	syslogListener, path := newTestLogListener(t, tmpdir, "syslog")
+	defer syslogListener.Close()
+	syslogSocketPath = path
+
+	journalListener, path := newTestLogListener(t, tmpdir, "journal")
+	defer journalListener.Close()
+	journalSocketPath = path
+
+	ccLog.Hooks = make(logrus.LevelHooks)
+	err = handleLogBackend("foo", "", logRotation{})
+	assert.Error(err)
+	assert.Empty(ccLog.Hooks)
+
+	// No global log path so nothing to do
+	err = handleLogBackend(fileLogBackend, "", logRotation{})
+	assert.NoError(err)
+	assert.Empty(ccLog.Hooks)
+
+	err = handleLogBackend(syslogLogBackend, "", logRotation{})
+	assert.NoError(err)
+	_, ok := ccLog.Hooks[logrus.InfoLevel][0].(*SyslogHook)
+	assert.True(ok)
+
+	ccLog.Hooks = make(logrus.LevelHooks)
+	err = handleLogBackend(journaldLogBackend, "", logRotation{})
+	assert.NoError(err)
+	_, ok = ccLog.Hooks[logrus.InfoLevel][0].(*JournalHook)
+	assert.True(ok)
+
+	ccLog.WithField("container", "xyz").Info("hello journal")
+
+	msg := string(readTestLogMessage(t, journalListener))
+	assert.Contains(msg, "MESSAGE=hello journal\n")
+	assert.Contains(msg, "CONTAINER=xyz\n")
+}
@@ -15,11 +15,14 @@
 package main
 
 import (
+	"compress/gzip"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/Sirupsen/logrus"
 )
@@ -42,6 +45,19 @@ const (
 	// globalLogFlags are the flags used to open the global log
 	// file.
 	globalLogFlags = (os.O_CREATE | os.O_WRONLY | os.O_APPEND | os.O_SYNC)
+
+	// globalLogLockSuffix is appended to the global log path to
+	// create the name of the file used to serialise writes (and
+	// rotation) between concurrent runtime processes.
+	globalLogLockSuffix = ".lock"
+
+	// globalLogCompressSuffix is appended to the name of rotated
+	// global log files when compression is enabled.
+	globalLogCompressSuffix = ".gz"
+
+	// globalLogTmpSuffix is appended to the name of a rotated global
+	// log file being compressed.
+	globalLogTmpSuffix = ".tmp"
 )
 
 var (
@@ -58,15 +74,30 @@ var (
 // container-specific paths to provide a persistent log of all runtime
 // activity, including debugging failures.
 type GlobalLogHook struct {
-	path string
-	file *os.File
+	path     string
+	file     *os.File
+	lockFile *os.File
+	rotation logRotation
+}
+
+// logRotation describes how the global log is rotated.
+type logRotation struct {
+	// maxSize is the size in bytes the global log is allowed to
+	// reach before it is rotated. Zero disables rotation.
+	maxSize int64
+
+	// maxFiles is the number of rotated log files to keep.
+	maxFiles int
+
+	// compress specifies whether rotated log files are gzipped.
+	compress bool
 }
 
 // handleGlobalLog sets up the global logger.
 //
 // Note that the logfile path may be blank since this function also
 // checks the environment to see whether global logging is required.
-func handleGlobalLog(logfilePath string) error {
+func handleGlobalLog(logfilePath string, rotation logRotation) error {
 
 	// the environment variable takes priority
 	path := os.Getenv(globalLogEnv)
@@ -91,7 +122,7 @@ func handleGlobalLog(logfilePath string) error {
 		return err
 	}
 
-	hook, err := newGlobalLogHook(path)
+	hook, err := newGlobalLogHook(path, rotation)
 	if err != nil {
 		return err
 	}
@@ -103,7 +134,7 @@ func handleGlobalLog(logfilePath string) error {
 
 // newGlobalLogHook creates a new hook that can be used by a logrus
 // logger.
-func newGlobalLogHook(logfilePath string) (*GlobalLogHook, error) {
+func newGlobalLogHook(logfilePath string, rotation logRotation) (*GlobalLogHook, error) {
 	if logfilePath == "" {
 		return nil, errNeedGlobalLogPath
 	}
@@ -114,8 +145,18 @@ func newGlobalLogHook(logfilePath string) (*GlobalLogHook, error) {
 	}
 
 	hook := &GlobalLogHook{
-		path: logfilePath,
-		file: f,
+		path:     logfilePath,
+		file:     f,
+		rotation: rotation,
+	}
+
+	if rotation.maxSize > 0 {
+		hook.lockFile, err = os.OpenFile(logfilePath+globalLogLockSuffix,
+			os.O_CREATE|os.O_RDWR, globalLogMode)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
 	}
 
 	return hook, nil
@@ -133,15 +174,199 @@ func (hook *GlobalLogHook) Fire(entry *logrus.Entry) error {
 
 	// Ignore any formatter that has been used and log in a custom format
 	// to the global log.
-	_, err := hook.file.WriteString(fmt.Sprintf("%v:%d:%s:%s:%s\n",
+	line := fmt.Sprintf("%v:%d:%s:%s:%s\n",
 		entry.Time,
 		os.Getpid(),
 		name,
 		entry.Level,
-		entry.Message))
+		entry.Message)
+
+	if hook.rotation.maxSize > 0 {
+		return hook.writeRotated(line)
+	}
+
+	_, err := hook.file.WriteString(line)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// writeRotated writes the specified line to the global log, rotating
+// the log first if the line would make it exceed its maximum size.
+//
+// Since multiple runtimes may be writing to the global log at the same
+// time, the lock file is held for the duration of the operation and
+// the log is re-opened if another runtime has rotated it.
+func (hook *GlobalLogHook) writeRotated(line string) error {
+	fd := int(hook.lockFile.Fd())
+
+	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(fd, syscall.LOCK_UN)
+
+	if err := hook.reopenIfRotated(); err != nil {
+		return err
+	}
+
+	st, err := hook.file.Stat()
 	if err != nil {
 		return err
 	}
 
+	if st.Size() > 0 && st.Size()+int64(len(line)) > hook.rotation.maxSize {
+		if err := hook.rotate(); err != nil {
+			return err
+		}
+	}
+
+	_, err = hook.file.WriteString(line)
+
+	return err
+}
+
+// reopenIfRotated re-opens the global log if the file currently open
+// is no longer the one at the global log path.
+func (hook *GlobalLogHook) reopenIfRotated() error {
+	current, err := hook.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	st, err := os.Stat(hook.path)
+	if err == nil && os.SameFile(current, st) {
+		return nil
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return hook.reopen()
+}
+
+func (hook *GlobalLogHook) reopen() error {
+	f, err := os.OpenFile(hook.path, globalLogFlags, globalLogMode)
+	if err != nil {
+		return err
+	}
+
+	hook.file.Close()
+	hook.file = f
+
 	return nil
 }
+
+// rotatedLogPath returns the path of the specified rotated global log
+// file.
+func (hook *GlobalLogHook) rotatedLogPath(index int) string {
+	path := fmt.Sprintf("%s.%d", hook.path, index)
+
+	if hook.rotation.compress {
+		path += globalLogCompressSuffix
+	}
+
+	return path
+}
+
+// rotate moves the current global log out of the way, discarding the
+// oldest rotated log file if necessary, and then opens a new global
+// log. The caller must hold the lock file.
+//
+// When the rotated logs are compressed, the current global log is
+// compressed before the rotated logs are shifted, so that a failure
+// leaves all the logs as they were.
+func (hook *GlobalLogHook) rotate() error {
+	if hook.rotation.maxFiles <= 0 {
+		if err := os.Remove(hook.path); err != nil {
+			return err
+		}
+
+		return hook.reopen()
+	}
+
+	rotated := hook.rotatedLogPath(1)
+	source := hook.path
+
+	if hook.rotation.compress {
+		source = rotated + globalLogTmpSuffix
+
+		if err := compressFile(hook.path, source); err != nil {
+			return fmt.Errorf("Failed to compress rotated global log: %v", err)
+		}
+	}
+
+	if err := hook.shiftRotatedLogs(); err != nil {
+		if hook.rotation.compress {
+			os.Remove(source)
+		}
+
+		return err
+	}
+
+	if err := os.Rename(source, rotated); err != nil {
+		return err
+	}
+
+	if hook.rotation.compress {
+		if err := os.Remove(hook.path); err != nil {
+			return err
+		}
+	}
+
+	return hook.reopen()
+}
+
+// shiftRotatedLogs renames each rotated global log file to the next
+// index, discarding the oldest one.
+func (hook *GlobalLogHook) shiftRotatedLogs() error {
+	oldest := hook.rotatedLogPath(hook.rotation.maxFiles)
+	if err := os.Remove(oldest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := hook.rotation.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(hook.rotatedLogPath(i), hook.rotatedLogPath(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compressFile gzips the source file into the destination file. On
+// failure, the destination file is removed.
+func compressFile(source, dest string) (err error) {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, globalLogMode)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(dest)
+		}
+	}()
+
+	zw := gzip.NewWriter(out)
+
+	if _, err = io.Copy(zw, in); err != nil {
+		return err
+	}
+
+	if err = zw.Close(); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
@@ -15,12 +15,16 @@
 package main
 
 import (
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -77,7 +81,7 @@ func TestNewGlobalLogHook(t *testing.T) {
 	}
 
 	for _, d := range data {
-		hook, err := newGlobalLogHook(d.path)
+		hook, err := newGlobalLogHook(d.path, logRotation{})
 		if d.expectFailure {
 			if err == nil {
 				t.Fatal(fmt.Sprintf("unexpected succes from newGlobalLogHook(path=%v)", d.path))
@@ -124,7 +128,7 @@ func TestHandleGlobalLog(t *testing.T) {
 	}
 
 	for _, d := range data {
-		err := handleGlobalLog(d.path)
+		err := handleGlobalLog(d.path, logRotation{})
 		if d.expectFailure {
 			if err == nil {
 				t.Fatal(fmt.Sprintf("unexpected success from handleGlobalLog(path=%q)", d.path))
@@ -182,7 +186,7 @@ func TestHandleGlobalLogEnvVar(t *testing.T) {
 	os.Setenv(envvar, tmpfile2)
 	defer os.Unsetenv(envvar)
 
-	err = handleGlobalLog(tmpfile)
+	err = handleGlobalLog(tmpfile, logRotation{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -216,7 +220,7 @@ func TestLoggerFire(t *testing.T) {
 	ccLog = logrus.New()
 
 	logFile := path.Join(tmpdir, "a/b/global.log")
-	err = handleGlobalLog(logFile)
+	err = handleGlobalLog(logFile, logRotation{})
 	assert.NoError(t, err)
 
 	entry := &logrus.Entry{
@@ -242,3 +246,235 @@ func TestLoggerFire(t *testing.T) {
 	err = ccLog.Hooks.Fire(logrus.DebugLevel, entry)
 	assert.Error(t, err)
 }
+
+func TestGlobalLogRotation(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, compress := range []bool{false, true} {
+		tmpdir, err := ioutil.TempDir(testDir, "")
+		assert.NoError(err)
+
+		logFile := path.Join(tmpdir, "global.log")
+
+		rotation := logRotation{
+			maxSize:  256,
+			maxFiles: 2,
+			compress: compress,
+		}
+
+		hook, err := newGlobalLogHook(logFile, rotation)
+		assert.NoError(err)
+
+		entry := &logrus.Entry{
+			Logger:  ccLog,
+			Time:    time.Now().UTC(),
+			Level:   logrus.InfoLevel,
+			Message: strings.Repeat("x", 64),
+		}
+
+		for i := 0; i < 32; i++ {
+			err = hook.Fire(entry)
+			assert.NoError(err)
+		}
+
+		st, err := os.Stat(logFile)
+		assert.NoError(err)
+		assert.True(st.Size() <= rotation.maxSize)
+
+		assert.True(fileExists(logFile + globalLogLockSuffix))
+
+		for i := 1; i <= rotation.maxFiles; i++ {
+			rotated := hook.rotatedLogPath(i)
+			assert.True(fileExists(rotated), "rotated log %q missing", rotated)
+
+			if !compress {
+				continue
+			}
+
+			f, err := os.Open(rotated)
+			assert.NoError(err)
+
+			zr, err := gzip.NewReader(f)
+			assert.NoError(err)
+
+			data, err := ioutil.ReadAll(zr)
+			assert.NoError(err)
+			assert.Contains(string(data), entry.Message)
+
+			f.Close()
+		}
+
+		assert.False(fileExists(hook.rotatedLogPath(rotation.maxFiles + 1)))
+
+		// uncompressed versions should not be left behind
+		if compress {
+			assert.False(fileExists(logFile + ".1"))
+		}
+
+		os.RemoveAll(tmpdir)
+	}
+}
+
+func TestGlobalLogRotationCompressFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	logFile := path.Join(tmpdir, "global.log")
+
+	hook, err := newGlobalLogHook(logFile, logRotation{maxSize: 256, maxFiles: 2, compress: true})
+	assert.NoError(err)
+
+	err = ioutil.WriteFile(logFile, []byte("current"), testFileMode)
+	assert.NoError(err)
+
+	for i, data := range []string{"first", "second"} {
+		err = ioutil.WriteFile(hook.rotatedLogPath(i+1), []byte(data), testFileMode)
+		assert.NoError(err)
+	}
+
+	// a directory cannot be opened for writing
+	err = os.Mkdir(hook.rotatedLogPath(1)+globalLogTmpSuffix, testDirMode)
+	assert.NoError(err)
+
+	err = hook.rotate()
+	assert.Error(err)
+
+	// no log is lost or shifted
+	for file, expected := range map[string]string{
+		logFile:                "current",
+		hook.rotatedLogPath(1): "first",
+		hook.rotatedLogPath(2): "second",
+	} {
+		data, err := ioutil.ReadFile(file)
+		assert.NoError(err)
+		assert.Equal(expected, string(data))
+	}
+}
+
+func TestGlobalLogRotationNoFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	logFile := path.Join(tmpdir, "global.log")
+
+	hook, err := newGlobalLogHook(logFile, logRotation{maxSize: 256})
+	assert.NoError(err)
+
+	entry := &logrus.Entry{
+		Logger:  ccLog,
+		Time:    time.Now().UTC(),
+		Level:   logrus.InfoLevel,
+		Message: strings.Repeat("x", 64),
+	}
+
+	for i := 0; i < 8; i++ {
+		err = hook.Fire(entry)
+		assert.NoError(err)
+	}
+
+	st, err := os.Stat(logFile)
+	assert.NoError(err)
+	assert.True(st.Size() <= 256)
+
+	files, err := ioutil.ReadDir(tmpdir)
+	assert.NoError(err)
+
+	// only the log and its lock file
+	assert.Len(files, 2)
+}
+
+func TestCompressFileFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	source := path.Join(tmpdir, "global.log.1")
+	err = ioutil.WriteFile(source, []byte("foo"), testFileMode)
+	assert.NoError(err)
+
+	dest := path.Join(tmpdir, "global.log.1"+globalLogCompressSuffix)
+
+	// a directory cannot be opened for writing
+	err = os.Mkdir(dest, testDirMode)
+	assert.NoError(err)
+
+	err = compressFile(source, dest)
+	assert.Error(err)
+
+	// the source must be left untouched
+	data, err := ioutil.ReadFile(source)
+	assert.NoError(err)
+	assert.Equal("foo", string(data))
+}
+
+// TestGlobalLogRotationConcurrent checks that no log entries are lost
+// when multiple writers (which would normally be separate runtime
+// processes) are rotating the same global log.
+func TestGlobalLogRotationConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	logFile := path.Join(tmpdir, "global.log")
+
+	const writers = 4
+	const entries = 50
+
+	rotation := logRotation{
+		maxSize:  1024,
+		maxFiles: writers * entries,
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < writers; i++ {
+		hook, err := newGlobalLogHook(logFile, rotation)
+		assert.NoError(err)
+
+		wg.Add(1)
+		go func(hook *GlobalLogHook, writer int) {
+			defer wg.Done()
+
+			for j := 0; j < entries; j++ {
+				entry := &logrus.Entry{
+					Logger:  ccLog,
+					Time:    time.Now().UTC(),
+					Level:   logrus.InfoLevel,
+					Message: fmt.Sprintf("writer %d entry %d", writer, j),
+				}
+
+				err := hook.Fire(entry)
+				assert.NoError(err)
+			}
+		}(hook, i)
+	}
+
+	wg.Wait()
+
+	files, err := filepath.Glob(logFile + "*")
+	assert.NoError(err)
+
+	lines := 0
+	for _, file := range files {
+		if strings.HasSuffix(file, globalLogLockSuffix) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(file)
+		assert.NoError(err)
+
+		lines += strings.Count(string(data), "\n")
+	}
+
+	assert.Equal(writers*entries, lines)
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/Sirupsen/logrus"
@@ -82,6 +83,9 @@ func beforeSubcommands(context *cli.Context) error {
 	// Set virtcontainers logger.
 	vc.SetLogger(ccLog)
 
+	cgroupsRecordDir = filepath.Join(context.GlobalString("root"), cgroupsRecordDirName)
+	containerIndexDir = context.GlobalString("root")
+
 	ignoreLogging := false
 	if context.NArg() == 1 && context.Args()[0] == "cc-env" {
 		// "cc-env" should simply report the logging setup
@@ -93,6 +97,11 @@ func beforeSubcommands(context *cli.Context) error {
 		fatal(err)
 	}
 
+	// Trace the command, ensuring the trace is exported even if the
+	// runtime exits early.
+	startTrace(context.Args().First())
+	atexit(exportTrace)
+
 	ccLog.Infof("%v (version %v, commit %v) called as: %v", name, version, commit, context.Args())
 	ccLog.Infof("Using configuration file %q", configFile)
 
@@ -106,6 +115,11 @@ func beforeSubcommands(context *cli.Context) error {
 	return nil
 }
 
+func afterSubcommands(context *cli.Context) error {
+	exportTrace()
+	return nil
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = name
@@ -158,6 +172,9 @@ func main() {
 	app.Commands = []cli.Command{
 		checkCLICommand,
 		envCLICommand,
+		gcCLICommand,
+		migrateStorageCLICommand,
+		logsCLICommand,
 		createCLICommand,
 		deleteCLICommand,
 		execCLICommand,
@@ -172,6 +189,11 @@ func main() {
 	}
 
 	app.Before = beforeSubcommands
+	app.After = afterSubcommands
+
+	// Ensure the atexit handlers are run if a command returns an
+	// exit code.
+	cli.OsExiter = exit
 	// If the command returns an error, cli takes upon itself to print
 	// the error on cli.ErrWriter and exit.
 	// Use our own writer here to ensure the log gets sent to the right
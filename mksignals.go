@@ -0,0 +1,173 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build ignore
+// +build ignore
+
+// mksignals generates the table of signals supported by the kill
+// command from the signal definitions of the C library, in the same way
+// as the golang.org/x/sys/unix tables are generated. Since the signal
+// numbers depend on the architecture, the table is generated for the
+// architecture of the C library, using its C (cross) compiler:
+//
+//	$ go run mksignals.go -arch arm64 -cc aarch64-linux-gnu-gcc > signals-generated_arm64.go
+//
+// "make generate-signals" generates the table of every supported
+// architecture.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var defineRegex = regexp.MustCompile(`^#define (SIG[A-Z0-9]+|__SIGRTMIN|__SIGRTMAX) (\S+)$`)
+
+func die(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "mksignals: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	defaultCC := os.Getenv("CC")
+	if defaultCC == "" {
+		defaultCC = "cc"
+	}
+
+	goarch := flag.String("arch", runtime.GOARCH, "architecture (GOARCH) of the C library")
+	cc := flag.String("cc", defaultCC, "C compiler of the architecture")
+	flag.Parse()
+
+	cmd := exec.Command(*cc, "-E", "-dM", "-")
+	cmd.Stdin = strings.NewReader("#include <signal.h>\n")
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		die("failed to run %s: %v", *cc, err)
+	}
+
+	defines := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if m := defineRegex.FindStringSubmatch(scanner.Text()); m != nil {
+			defines[m[1]] = m[2]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		die("failed to read definitions: %v", err)
+	}
+
+	signals := make(map[string]int)
+	preferred := make(map[int]string)
+
+	for name, value := range defines {
+		if strings.HasPrefix(name, "__") {
+			continue
+		}
+
+		alias := false
+
+		// Aliases are defined in terms of another signal name.
+		if target, ok := defines[value]; ok {
+			value = target
+			alias = true
+		}
+
+		num, err := strconv.Atoi(value)
+		if err != nil || num <= 0 || num >= 32 {
+			// SIGRTMIN, SIGRTMAX and SIGSTKSZ
+			continue
+		}
+
+		signals[name] = num
+
+		if !alias {
+			preferred[num] = name
+		}
+	}
+
+	// SIGUNUSED was removed from the C library (glibc 2.26) but is
+	// still accepted for compatibility, as an alias of SIGSYS.
+	if _, ok := signals["SIGUNUSED"]; !ok {
+		if num, ok := signals["SIGSYS"]; ok {
+			signals["SIGUNUSED"] = num
+		}
+	}
+
+	rtMin, err := strconv.Atoi(defines["__SIGRTMIN"])
+	if err != nil {
+		die("invalid __SIGRTMIN: %q", defines["__SIGRTMIN"])
+	}
+
+	rtMax, err := strconv.Atoi(defines["__SIGRTMAX"])
+	if err != nil {
+		die("invalid __SIGRTMAX: %q", defines["__SIGRTMAX"])
+	}
+
+	var names []string
+	for name := range signals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var nums []int
+	for num := range preferred {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by mksignals.go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "//go:build linux && %s\n", *goarch)
+	fmt.Fprintf(&buf, "// +build linux,%s\n\n", *goarch)
+	fmt.Fprintf(&buf, "package main\n\nimport \"syscall\"\n\n")
+
+	fmt.Fprintf(&buf, "// signals maps the names of the standard signals to their numbers.\n")
+	fmt.Fprintf(&buf, "var signals = map[string]syscall.Signal{\n")
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%q: %d,\n", name, signals[name])
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+
+	fmt.Fprintf(&buf, "// signalNames maps the numbers of the standard signals to their\n// preferred names.\n")
+	fmt.Fprintf(&buf, "var signalNames = map[syscall.Signal]string{\n")
+	for _, num := range nums {
+		fmt.Fprintf(&buf, "%d: %q,\n", num, preferred[num])
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+
+	fmt.Fprintf(&buf, "// kernelSigRtMin and sigRtMax are the range of real-time signals\n// supported by the kernel.\n")
+	fmt.Fprintf(&buf, "const (\nkernelSigRtMin = %d\nsigRtMax = %d\n)\n", rtMin, rtMax)
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		die("failed to format output: %v", err)
+	}
+
+	os.Stdout.Write(src)
+}
@@ -20,7 +20,6 @@ import (
 	"net"
 	"os"
 	"path/filepath"
-	"strings"
 	"syscall"
 
 	vc "github.com/containers/virtcontainers"
@@ -54,43 +53,60 @@ var cgroupsDirPath = "/sys/fs/cgroup"
 // An error is returned if >1 containers are found with the specified
 // prefix.
 func getContainerInfo(containerID string) (vc.ContainerStatus, string, error) {
-	var cStatus vc.ContainerStatus
-	var podID string
-
 	// container ID MUST be provided.
 	if containerID == "" {
 		return vc.ContainerStatus{}, "", fmt.Errorf("Missing container ID")
 	}
 
-	podStatusList, err := vc.ListPod()
+	entry, err := lookupContainer(containerID, false)
+	if err != nil || entry.ID == "" {
+		return vc.ContainerStatus{}, "", err
+	}
+
+	cStatus, err := vc.StatusContainer(entry.PodID, entry.ID)
+	if err == nil && cStatus.ID != "" {
+		return cStatus, entry.PodID, nil
+	}
+
+	// The index is out of date: the container, or its pod, has been
+	// removed without the index being updated.
+	ccLog.Warnf("Container %s not found in pod %s, rebuilding container index", entry.ID, entry.PodID)
+
+	if entry, err = lookupContainer(containerID, true); err != nil || entry.ID == "" {
+		return vc.ContainerStatus{}, "", err
+	}
+
+	cStatus, err = vc.StatusContainer(entry.PodID, entry.ID)
 	if err != nil {
 		return vc.ContainerStatus{}, "", err
 	}
 
-	matchFound := false
-	for _, podStatus := range podStatusList {
-		for _, containerStatus := range podStatus.ContainersStatus {
-			if containerStatus.ID == containerID {
-				return containerStatus, podStatus.ID, nil
-			}
+	return cStatus, entry.PodID, nil
+}
 
-			if strings.HasPrefix(containerStatus.ID, containerID) {
-				if matchFound {
-					return vc.ContainerStatus{}, "", errPrefixContIDNotUnique
-				}
+// lookupContainer looks up the container whose ID is, or starts with,
+// prefix in the container index, after rebuilding the index if rebuild
+// is true.
+//
+// A container which is not found, or a prefix matching several
+// containers, is reported as is: the index is only rebuilt when it is
+// missing or invalid, or when it refers to a container which no longer
+// exists (see getContainerInfo).
+func lookupContainer(prefix string, rebuild bool) (containerIndexEntry, error) {
+	var index *containerIndex
+	var err error
 
-				matchFound = true
-				cStatus = containerStatus
-				podID = podStatus.ID
-			}
-		}
+	if rebuild {
+		index, err = rebuildContainerIndex()
+	} else {
+		index, err = loadContainerIndex()
 	}
 
-	if matchFound {
-		return cStatus, podID, nil
+	if err != nil {
+		return containerIndexEntry{}, err
 	}
 
-	return vc.ContainerStatus{}, "", nil
+	return index.lookup(prefix)
 }
 
 func getExistingContainerInfo(containerID string) (vc.ContainerStatus, string, error) {
@@ -104,6 +120,9 @@ func getExistingContainerInfo(containerID string) (vc.ContainerStatus, string, e
 		return vc.ContainerStatus{}, "", fmt.Errorf("Container ID does not exist")
 	}
 
+	// Record the remainder of the operation in the pod log.
+	setupPodLog(podID)
+
 	return cStatus, podID, nil
 }
 
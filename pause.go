@@ -17,6 +17,7 @@ package main
 
 import (
 	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
 )
 
@@ -29,6 +30,9 @@ var pauseCLICommand = cli.Command{
 
 Where "<container-id>" is the container name to be paused.`,
 	Description: `The pause command suspends all processes in a container.
+	Pausing the sandbox container of a pod pauses the whole pod. Pausing
+	another container of a pod also pauses the whole pod if the agent
+	cannot pause a single container, which is the case of hyperstart.
 
 	` + noteText,
 	Action: func(context *cli.Context) error {
@@ -51,16 +55,43 @@ Where "<container-id>" is the container name to be resumed.`,
 }
 
 func toggleContainerPause(containerID string, pause bool) (err error) {
+	command := "resume"
+	if pause {
+		command = "pause"
+	}
+
+	audit := newAuditEntry(command, containerID)
+	defer func() { audit.finish(err) }()
+
 	// Checks the MUST and MUST NOT from OCI runtime specification
-	_, podID, err := getExistingContainerInfo(containerID)
+	status, podID, err := getExistingContainerInfo(containerID)
 	if err != nil {
 		return err
 	}
 
-	if pause {
-		_, err = vc.PausePod(podID)
+	audit.ContainerID = status.ID
+	audit.PodID = podID
+
+	containerType, err := oci.GetContainerType(status.Annotations)
+	if err != nil {
+		return err
+	}
+
+	// Pausing the sandbox pauses the whole VM, while pausing any other
+	// container only freezes its own processes inside the VM, if the
+	// agent supports it, or pauses the whole VM otherwise.
+	if containerType.IsPod() {
+		if pause {
+			_, err = vc.PausePod(podID)
+		} else {
+			_, err = vc.ResumePod(podID)
+		}
 	} else {
-		_, err = vc.ResumePod(podID)
+		if pause {
+			_, err = vc.PauseContainer(podID, status.ID)
+		} else {
+			_, err = vc.ResumeContainer(podID, status.ID)
+		}
 	}
 
 	return err
@@ -0,0 +1,255 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+)
+
+const (
+	// podLogDirMode is the mode used to create the pod log
+	// directories.
+	podLogDirMode = os.FileMode(0750)
+
+	// podLogMode is the mode used to create the pod log files.
+	podLogMode = os.FileMode(0640)
+
+	// podLogFlags are the flags used to open the pod runtime log.
+	podLogFlags = (os.O_CREATE | os.O_WRONLY | os.O_APPEND | os.O_SYNC)
+
+	// Names of the files in a pod log directory.
+	podConsoleLog = "console.log"
+	podShimLog    = "shim.log"
+	podRuntimeLog = "runtime.log"
+
+	// podLogDeletedMarker is created in a pod log directory when the
+	// pod is deleted. Its modification time determines when the pod
+	// logs expire.
+	podLogDeletedMarker = "deleted"
+)
+
+// podLogFiles lists the pod log files in the order they are displayed.
+var podLogFiles = []string{podConsoleLog, podShimLog, podRuntimeLog}
+
+// ccPodLog is the per-pod log configuration. It is nil if per-pod logs
+// are not enabled.
+var ccPodLog *podLog
+
+// podLog describes where per-pod logs are stored and how long they are
+// kept for once the pod has been deleted.
+type podLog struct {
+	dir       string
+	retention time.Duration
+
+	// hooked records the pods whose runtime log has been added as a
+	// hook to ccLog.
+	hooked map[string]bool
+}
+
+// PodLogHook is a logrus hook that appends all log entries to the
+// runtime log of a pod.
+type PodLogHook struct {
+	path string
+	file *os.File
+}
+
+// handlePodLog sets up per-pod logging. If the directory is blank,
+// per-pod logs are disabled.
+func handlePodLog(dir string, retention time.Duration) error {
+	if dir == "" {
+		ccPodLog = nil
+		return nil
+	}
+
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("Pod log directory must be absolute: %v", dir)
+	}
+
+	if err := os.MkdirAll(dir, podLogDirMode); err != nil {
+		return err
+	}
+
+	ccPodLog = &podLog{
+		dir:       dir,
+		retention: retention,
+		hooked:    make(map[string]bool),
+	}
+
+	return nil
+}
+
+// podDir returns the log directory of the specified pod.
+func (p *podLog) podDir(podID string) string {
+	return filepath.Join(p.dir, podID)
+}
+
+// podLogConfig updates the runtime configuration used to create the
+// specified pod such that the console and shim output is written to
+// the pod log directory.
+func podLogConfig(podID string, runtimeConfig *oci.RuntimeConfig) error {
+	if ccPodLog == nil {
+		return nil
+	}
+
+	dir := ccPodLog.podDir(podID)
+
+	// Remove any logs left over by a previous pod with the same ID.
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, podLogDirMode); err != nil {
+		return err
+	}
+
+	runtimeConfig.HypervisorConfig.ConsoleLogPath = filepath.Join(dir, podConsoleLog)
+
+	if shimConfig, ok := runtimeConfig.ShimConfig.(vc.CCShimConfig); ok {
+		shimConfig.LogPath = filepath.Join(dir, podShimLog)
+		runtimeConfig.ShimConfig = shimConfig
+	}
+
+	return nil
+}
+
+// setupPodLog arranges for all subsequent runtime log entries to be
+// appended to the runtime log of the specified pod.
+//
+// Failure is logged but is not fatal since the pod logs are only a
+// debugging aid.
+func setupPodLog(podID string) {
+	if ccPodLog == nil || podID == "" || ccPodLog.hooked[podID] {
+		return
+	}
+
+	hook, err := newPodLogHook(filepath.Join(ccPodLog.podDir(podID), podRuntimeLog))
+	if err != nil {
+		ccLog.Warnf("Failed to setup pod log for pod %v: %v", podID, err)
+		return
+	}
+
+	ccLog.Hooks.Add(hook)
+	ccPodLog.hooked[podID] = true
+}
+
+// newPodLogHook creates a new hook that appends log entries to the
+// specified file.
+func newPodLogHook(path string) (*PodLogHook, error) {
+	if err := os.MkdirAll(filepath.Dir(path), podLogDirMode); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, podLogFlags, podLogMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PodLogHook{
+		path: path,
+		file: f,
+	}, nil
+}
+
+// Levels informs the logrus Logger which log levels this hook supports.
+func (hook *PodLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire is called by the logrus logger when data is available for the
+// hook.
+func (hook *PodLogHook) Fire(entry *logrus.Entry) error {
+	msg := entry.Message
+
+	if fields := formatLogFields(entry.Data); fields != "" {
+		msg = fmt.Sprintf("%s %s", msg, fields)
+	}
+
+	// Use the same format as the global log.
+	line := fmt.Sprintf("%v:%d:%s:%s:%s\n",
+		entry.Time,
+		os.Getpid(),
+		name,
+		entry.Level,
+		msg)
+
+	_, err := hook.file.WriteString(line)
+
+	return err
+}
+
+// markPodLogDeleted records that the specified pod has been deleted so
+// that its logs are removed once the retention period has expired.
+func markPodLogDeleted(podID string) error {
+	if ccPodLog == nil {
+		return nil
+	}
+
+	dir := ccPodLog.podDir(podID)
+
+	if !fileExists(dir) {
+		return nil
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, podLogDeletedMarker), nil, podLogMode)
+}
+
+// prunePodLogs removes the logs of all deleted pods whose retention
+// period has expired.
+func prunePodLogs() error {
+	if ccPodLog == nil {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(ccPodLog.dir)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(ccPodLog.dir, entry.Name())
+
+		st, err := os.Stat(filepath.Join(dir, podLogDeletedMarker))
+		if err != nil {
+			// pod not deleted
+			continue
+		}
+
+		if now.Sub(st.ModTime()) < ccPodLog.retention {
+			continue
+		}
+
+		ccLog.Debugf("Removing expired pod logs %v", dir)
+
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
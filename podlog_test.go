@@ -0,0 +1,200 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPodLogPodID = "podlog-pod"
+
+// saveTestPodLog returns a function that restores the per-pod log
+// configuration and the ccLog hooks.
+func saveTestPodLog() func() {
+	savedPodLog := ccPodLog
+	savedHooks := ccLog.Hooks
+
+	ccLog.Hooks = make(logrus.LevelHooks)
+
+	return func() {
+		ccPodLog = savedPodLog
+		ccLog.Hooks = savedHooks
+	}
+}
+
+func TestHandlePodLog(t *testing.T) {
+	assert := assert.New(t)
+
+	defer saveTestPodLog()()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	err = handlePodLog("", time.Hour)
+	assert.NoError(err)
+	assert.Nil(ccPodLog)
+
+	err = handlePodLog("pods", time.Hour)
+	assert.Error(err)
+	assert.Nil(ccPodLog)
+
+	dir := filepath.Join(tmpdir, "pods")
+
+	err = handlePodLog(dir, time.Hour)
+	assert.NoError(err)
+	assert.NotNil(ccPodLog)
+	assert.Equal(time.Hour, ccPodLog.retention)
+	assert.True(fileExists(dir))
+	assert.Equal(filepath.Join(dir, testPodLogPodID), ccPodLog.podDir(testPodLogPodID))
+}
+
+func TestPodLogConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	defer saveTestPodLog()()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	runtimeConfig := oci.RuntimeConfig{
+		ShimType:   vc.CCShimType,
+		ShimConfig: vc.CCShimConfig{Path: "/shim"},
+	}
+
+	// per-pod logs disabled
+	err = handlePodLog("", 0)
+	assert.NoError(err)
+
+	err = podLogConfig(testPodLogPodID, &runtimeConfig)
+	assert.NoError(err)
+	assert.Empty(runtimeConfig.HypervisorConfig.ConsoleLogPath)
+	assert.Empty(runtimeConfig.ShimConfig.(vc.CCShimConfig).LogPath)
+
+	err = handlePodLog(tmpdir, 0)
+	assert.NoError(err)
+
+	// logs of a previous pod with the same ID are removed
+	podDir := ccPodLog.podDir(testPodLogPodID)
+	stale := filepath.Join(podDir, podRuntimeLog)
+	err = os.MkdirAll(podDir, testDirMode)
+	assert.NoError(err)
+	err = createEmptyFile(stale)
+	assert.NoError(err)
+
+	err = podLogConfig(testPodLogPodID, &runtimeConfig)
+	assert.NoError(err)
+	assert.True(fileExists(podDir))
+	assert.False(fileExists(stale))
+
+	assert.Equal(filepath.Join(podDir, podConsoleLog), runtimeConfig.HypervisorConfig.ConsoleLogPath)
+
+	shimConfig := runtimeConfig.ShimConfig.(vc.CCShimConfig)
+	assert.Equal("/shim", shimConfig.Path)
+	assert.Equal(filepath.Join(podDir, podShimLog), shimConfig.LogPath)
+}
+
+func TestSetupPodLog(t *testing.T) {
+	assert := assert.New(t)
+
+	defer saveTestPodLog()()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	err = handlePodLog(tmpdir, 0)
+	assert.NoError(err)
+
+	setupPodLog(testPodLogPodID)
+	assert.True(ccPodLog.hooked[testPodLogPodID])
+
+	// the hook is only added once
+	setupPodLog(testPodLogPodID)
+	assert.Len(ccLog.Hooks[logrus.InfoLevel], 1)
+
+	ccLog.WithField("container", "foo").Info("hello pod log")
+
+	path := filepath.Join(ccPodLog.podDir(testPodLogPodID), podRuntimeLog)
+
+	st, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(podLogMode, st.Mode().Perm())
+
+	err = grep(`(?m):info:hello pod log container=foo$`, path)
+	assert.NoError(err)
+}
+
+func TestPrunePodLogs(t *testing.T) {
+	assert := assert.New(t)
+
+	defer saveTestPodLog()()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	err = handlePodLog(tmpdir, time.Hour)
+	assert.NoError(err)
+
+	running := ccPodLog.podDir("running")
+	expired := ccPodLog.podDir("expired")
+	retained := ccPodLog.podDir("retained")
+
+	for _, dir := range []string{running, expired, retained} {
+		err = os.MkdirAll(dir, testDirMode)
+		assert.NoError(err)
+	}
+
+	// not created for a pod that has no logs
+	err = markPodLogDeleted("unknown")
+	assert.NoError(err)
+	assert.False(fileExists(ccPodLog.podDir("unknown")))
+
+	for _, podID := range []string{"expired", "retained"} {
+		err = markPodLogDeleted(podID)
+		assert.NoError(err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	err = os.Chtimes(filepath.Join(expired, podLogDeletedMarker), old, old)
+	assert.NoError(err)
+
+	err = prunePodLogs()
+	assert.NoError(err)
+
+	assert.True(fileExists(running))
+	assert.False(fileExists(expired))
+	assert.True(fileExists(retained))
+
+	// a zero retention removes the logs as soon as possible
+	ccPodLog.retention = 0
+
+	err = prunePodLogs()
+	assert.NoError(err)
+
+	assert.True(fileExists(running))
+	assert.False(fileExists(retained))
+}
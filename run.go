@@ -18,8 +18,6 @@ package main
 import (
 	"errors"
 	"fmt"
-	"os"
-	"syscall"
 
 	"github.com/containers/virtcontainers/pkg/oci"
 	"github.com/urfave/cli"
@@ -57,10 +55,16 @@ var runCLICommand = cli.Command{
 			Value: "",
 			Usage: "specify the file to write the process id to",
 		},
+		preserveFdsFlag,
 		cli.BoolFlag{
 			Name:  "detach, d",
 			Usage: "detach from the container's process",
 		},
+		cli.BoolFlag{
+			Name:   "no-subreaper",
+			Usage:  "disable the use of the subreaper used to reap reparented processes",
+			Hidden: true,
+		},
 	},
 	Action: func(context *cli.Context) error {
 		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
@@ -68,19 +72,30 @@ var runCLICommand = cli.Command{
 			return errors.New("invalid runtime config")
 		}
 
+		if err := checkPreservedFds(context.Uint("preserve-fds")); err != nil {
+			return err
+		}
+
 		return run(context.Args().First(),
 			context.String("bundle"),
 			context.String("console"),
 			context.String("console-socket"),
 			context.String("pid-file"),
 			context.Bool("detach"),
+			context.Bool("no-subreaper"),
 			runtimeConfig)
 	},
 }
 
-func run(containerID, bundle, console, consoleSocket, pidFile string, detach bool,
+func run(containerID, bundle, console, consoleSocket, pidFile string, detach, noSubreaper bool,
 	runtimeConfig oci.RuntimeConfig) error {
 
+	if !detach && !noSubreaper {
+		if err := setSubreaper(); err != nil {
+			return err
+		}
+	}
+
 	consolePath, err := setupConsole(console, consoleSocket)
 	if err != nil {
 		return err
@@ -101,14 +116,24 @@ func run(containerID, bundle, console, consoleSocket, pidFile string, detach boo
 			return fmt.Errorf("There are no containers running in the pod: %s", pod.ID())
 		}
 
-		p, err := os.FindProcess(containers[0].GetPid())
-		if err != nil {
-			return err
+		if consolePath != "" {
+			stop := forwardWinsize(pod.ID(), containers[0].ID(), "", consolePath)
+			defer stop()
 		}
 
-		ps, err := p.Wait()
+		// As for exec, signals are relayed to the container
+		// process by its shim.
+		stopSignals := forwardSignals(shimSignaller(containers[0].GetPid()))
+
+		// The shim only exits normally once the container process
+		// has exited: if the shim is killed, an error is returned
+		// and the container is not deleted.
+		status, err := waitShim(containers[0].GetPid())
+		stopSignals()
+		reapChildren()
+
 		if err != nil {
-			return fmt.Errorf("Process state %s: %s", ps.String(), err)
+			return err
 		}
 
 		// delete container's resources
@@ -117,7 +142,7 @@ func run(containerID, bundle, console, consoleSocket, pidFile string, detach boo
 		}
 
 		//runtime should forward container exit code to the system
-		return cli.NewExitError("", ps.Sys().(syscall.WaitStatus).ExitStatus())
+		return cli.NewExitError("", status)
 	}
 
 	return nil
@@ -0,0 +1,123 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// unforwardedSignals are the signals that are not forwarded to the
+// container process by a foreground run or exec, either because they
+// cannot be caught, or because they relate to the runtime itself
+// (SIGWINCH is handled by forwardWinsize and SIGURG is used by the Go
+// scheduler).
+var unforwardedSignals = map[syscall.Signal]bool{
+	syscall.SIGCHLD:  true,
+	syscall.SIGKILL:  true,
+	syscall.SIGPIPE:  true,
+	syscall.SIGSTOP:  true,
+	syscall.SIGURG:   true,
+	syscall.SIGWINCH: true,
+}
+
+// forwardedSignals returns the signals forwarded to the container
+// process by a foreground run or exec.
+func forwardedSignals() []os.Signal {
+	var sigs []os.Signal
+
+	for _, sig := range signals {
+		if !unforwardedSignals[sig] {
+			sigs = append(sigs, sig)
+		}
+	}
+
+	return sigs
+}
+
+// forwardSignals relays the signals received by the runtime (see
+// forwardedSignals) to the container process using kill until the
+// returned function is called.
+//
+// Failure to forward a signal is logged but is not fatal.
+func forwardSignals(kill func(syscall.Signal) error) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	sigCh := make(chan os.Signal, 32)
+	signal.Notify(sigCh, forwardedSignals()...)
+
+	go func() {
+		defer close(finished)
+
+		for {
+			select {
+			case <-done:
+				return
+			case s := <-sigCh:
+				sig := s.(syscall.Signal)
+
+				ccLog.Debugf("Forwarding signal %v to container", sig)
+
+				if err := kill(sig); err != nil {
+					ccLog.Warnf("Failed to forward signal %v to container: %v", sig, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+		<-finished
+	}
+}
+
+// shimSignaller returns a function to send signals to the shim with
+// the specified PID, which relays them to the process it represents.
+func shimSignaller(pid int) func(syscall.Signal) error {
+	return func(sig syscall.Signal) error {
+		return syscall.Kill(pid, sig)
+	}
+}
+
+// setSubreaper makes the runtime the child subreaper (see prctl(2)) of
+// the processes it creates, so that a process started by the shim that
+// is orphaned is reparented to (and so reaped by) the runtime.
+func setSubreaper() error {
+	return unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+}
+
+// reapChildren reaps any children of the runtime that have exited, such
+// as orphaned processes reparented to the runtime as subreaper.
+func reapChildren() {
+	for {
+		var ws syscall.WaitStatus
+
+		pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+
+		if err != nil || pid <= 0 {
+			return
+		}
+
+		ccLog.Debugf("Reaped process %d with exit status %d", pid, exitStatus(ws))
+	}
+}
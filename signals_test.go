@@ -0,0 +1,99 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardedSignals(t *testing.T) {
+	assert := assert.New(t)
+
+	sigs := forwardedSignals()
+	assert.NotEmpty(sigs)
+
+	for _, s := range sigs {
+		assert.False(unforwardedSignals[s.(syscall.Signal)], "signal %v", s)
+	}
+
+	assert.Contains(sigs, syscall.SIGTERM)
+	assert.Contains(sigs, syscall.SIGINT)
+	assert.Contains(sigs, syscall.SIGHUP)
+	assert.NotContains(sigs, syscall.SIGCHLD)
+	assert.NotContains(sigs, syscall.SIGWINCH)
+}
+
+func TestForwardSignals(t *testing.T) {
+	assert := assert.New(t)
+
+	forwarded := make(chan syscall.Signal, 1)
+
+	stop := forwardSignals(func(sig syscall.Signal) error {
+		forwarded <- sig
+		return nil
+	})
+
+	err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	assert.NoError(err)
+
+	select {
+	case sig := <-forwarded:
+		assert.Equal(syscall.SIGUSR1, sig)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for signal to be forwarded")
+	}
+
+	stop()
+}
+
+func TestShimSignaller(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := exec.Command("sleep", "60")
+	err := cmd.Start()
+	assert.NoError(err)
+
+	err = shimSignaller(cmd.Process.Pid)(syscall.SIGTERM)
+	assert.NoError(err)
+
+	var ws syscall.WaitStatus
+	_, err = syscall.Wait4(cmd.Process.Pid, &ws, 0, nil)
+	assert.NoError(err)
+	assert.Equal(syscall.SIGTERM, ws.Signal())
+}
+
+func TestReapChildren(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := exec.Command("true")
+	err := cmd.Start()
+	assert.NoError(err)
+
+	// wait for the process to become a zombie
+	for i := 0; i < 100 && processRunning(cmd.Process.Pid); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	reapChildren()
+
+	// the process has already been reaped
+	_, err = syscall.Wait4(cmd.Process.Pid, nil, syscall.WNOHANG, nil)
+	assert.Equal(syscall.ECHILD, err)
+}
@@ -48,7 +48,10 @@ var startCLICommand = cli.Command{
 	},
 }
 
-func start(containerID string) (*vc.Pod, error) {
+func start(containerID string) (pod *vc.Pod, err error) {
+	audit := newAuditEntry("start", containerID)
+	defer func() { audit.finish(err) }()
+
 	// Checks the MUST and MUST NOT from OCI runtime specification
 	status, podID, err := getExistingContainerInfo(containerID)
 	if err != nil {
@@ -56,6 +59,8 @@ func start(containerID string) (*vc.Pod, error) {
 	}
 
 	containerID = status.ID
+	audit.ContainerID = containerID
+	audit.PodID = podID
 
 	containerType, err := oci.GetContainerType(status.Annotations)
 	if err != nil {
@@ -63,13 +68,20 @@ func start(containerID string) (*vc.Pod, error) {
 	}
 
 	if containerType.IsPod() {
-		return vc.StartPod(podID)
-	}
+		pod, err = vc.StartPod(podID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		c, err := vc.StartContainer(podID, containerID)
+		if err != nil {
+			return nil, err
+		}
 
-	c, err := vc.StartContainer(podID, containerID)
-	if err != nil {
-		return nil, err
+		pod = c.Pod()
 	}
 
-	return c.Pod(), nil
+	setInitialWinsize(podID, status)
+
+	return pod, nil
 }
@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"os"
 
+	vc "github.com/containers/virtcontainers"
 	"github.com/containers/virtcontainers/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
 )
 
@@ -32,19 +34,80 @@ var stateCLICommand = cli.Command{
    <container-id> is your name for the instance of the container`,
 	Description: `The state command outputs current state information for the
 instance of a container.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "cc-all",
+			Usage: "display all available " + project + " information",
+		},
+	},
 	Action: func(context *cli.Context) error {
 		args := context.Args()
 		if len(args) != 1 {
 			return fmt.Errorf("Expecting only one container ID, got %d: %v", len(args), []string(args))
 		}
 
-		return state(args.First())
+		return state(args.First(), context.Bool("cc-all"))
 	},
 }
 
-func state(containerID string) error {
+// fullState is the state of a container, along with the details of the
+// VM hosting it if requested.
+type fullState struct {
+	specs.State
+	ClearContainers *vmDetails `json:"clearcontainers,omitempty"`
+}
+
+// vmDetails stores details of the pod a container belongs to, and of
+// the VM hosting the pod.
+type vmDetails struct {
+	PodID string `json:"podId"`
+	// ProxyURL is the URL of the proxy handling the pod
+	ProxyURL string `json:"proxyURL"`
+	// ShimPid is the PID of the shim of the container process
+	ShimPid    int                 `json:"shimPid"`
+	Hypervisor vmHypervisorDetails `json:"hypervisor"`
+	// VCPUs is the number of virtual CPUs of the VM
+	VCPUs uint32 `json:"vcpus"`
+	// Memory is the amount of memory of the VM in MiB
+	Memory  uint32       `json:"memory"`
+	Sockets vmSockets    `json:"sockets"`
+	Network []vmEndpoint `json:"network"`
+}
+
+// vmHypervisorDetails stores details of the hypervisor running a VM.
+// Version is the version the hypervisor reported when the VM was
+// started, which may differ from the one now installed at Path.
+type vmHypervisorDetails struct {
+	// Pid is the PID of the hypervisor, or 0 if the VM is not running
+	Pid        int    `json:"pid"`
+	Path       string `json:"path"`
+	Version    string `json:"version"`
+	KernelPath string `json:"kernelPath"`
+	ImagePath  string `json:"imagePath"`
+}
+
+// vmSockets stores the paths of the sockets of the hypervisor.
+type vmSockets struct {
+	QMPMonitor string `json:"qmpMonitor"`
+	QMPControl string `json:"qmpControl"`
+	Console    string `json:"console"`
+}
+
+// vmEndpoint stores details of a network interface of a VM.
+type vmEndpoint struct {
+	// Name is the name of the virtual interface in the network
+	// namespace of the pod
+	Name string `json:"name"`
+	// TAP is the name of the TAP interface connected to the VM
+	TAP string `json:"tap"`
+	// MAC is the MAC address of the network interface of the VM
+	MAC string   `json:"mac"`
+	IPs []string `json:"ips,omitempty"`
+}
+
+func state(containerID string, showAll bool) error {
 	// Checks the MUST and MUST NOT from OCI runtime specification
-	status, _, err := getExistingContainerInfo(containerID)
+	status, podID, err := getExistingContainerInfo(containerID)
 	if err != nil {
 		return err
 	}
@@ -55,9 +118,28 @@ func state(containerID string) error {
 		return err
 	}
 
-	stateJSON, err := json.Marshal(state)
-	if err != nil {
-		return err
+	var stateJSON []byte
+
+	if showAll {
+		podStatus, err := vc.StatusPod(podID)
+		if err != nil {
+			return err
+		}
+
+		details := getVMDetails(podStatus, status)
+
+		stateJSON, err = json.Marshal(fullState{
+			State:           state,
+			ClearContainers: &details,
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		stateJSON, err = json.Marshal(state)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Print stateJSON to stdout
@@ -65,3 +147,52 @@ func state(containerID string) error {
 
 	return nil
 }
+
+// getVMDetails returns the details of the pod, and of its VM, the
+// container with the specified status belongs to.
+func getVMDetails(pod vc.PodStatus, container vc.ContainerStatus) vmDetails {
+	vcpus, memory := podResources(pod)
+
+	details := vmDetails{
+		PodID:    pod.ID,
+		ProxyURL: pod.State.URL,
+		ShimPid:  container.PID,
+		Hypervisor: vmHypervisorDetails{
+			Pid:        pod.HypervisorPID,
+			Path:       pod.HypervisorConfig.HypervisorPath,
+			Version:    unknown,
+			KernelPath: pod.HypervisorConfig.KernelPath,
+			ImagePath:  pod.HypervisorConfig.ImagePath,
+		},
+		VCPUs:  vcpus,
+		Memory: memory,
+		Sockets: vmSockets{
+			QMPMonitor: pod.HypervisorSockets.QMPMonitor,
+			QMPControl: pod.HypervisorSockets.QMPControl,
+			Console:    pod.HypervisorSockets.Console,
+		},
+		Network: []vmEndpoint{},
+	}
+
+	if pod.State.HypervisorVersion != "" {
+		details.Hypervisor.Version = pod.State.HypervisorVersion
+	}
+
+	for _, endpoint := range pod.NetworkNS.Endpoints {
+		vmEndpoint := vmEndpoint{
+			Name: endpoint.NetPair.VirtIface.Name,
+			TAP:  endpoint.NetPair.TAPIface.Name,
+			MAC:  endpoint.NetPair.TAPIface.HardAddr,
+		}
+
+		for _, ip := range endpoint.Properties.IPs {
+			if ip != nil {
+				vmEndpoint.IPs = append(vmEndpoint.IPs, ip.Address.String())
+			}
+		}
+
+		details.Network = append(details.Network, vmEndpoint)
+	}
+
+	return details
+}
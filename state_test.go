@@ -0,0 +1,141 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/types/current"
+	vc "github.com/containers/virtcontainers"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetVMDetails(t *testing.T) {
+	assert := assert.New(t)
+
+	ip, ipNet, err := net.ParseCIDR("172.17.0.2/16")
+	assert.NoError(err)
+	ipNet.IP = ip
+
+	pod := vc.PodStatus{
+		ID: "pod",
+		State: vc.State{
+			URL:               "unix:///run/cc-proxy.sock",
+			HypervisorVersion: "2.7.0",
+		},
+		HypervisorConfig: vc.HypervisorConfig{
+			KernelPath:   "/kernel",
+			ImagePath:    "/image",
+			DefaultVCPUs: 1,
+			DefaultMemSz: 2048,
+		},
+		VMConfig: vc.Resources{
+			VCPUs: 2,
+		},
+		HypervisorPID: 1234,
+		HypervisorSockets: vc.HypervisorSockets{
+			QMPMonitor: "/run/pod/monitor.sock",
+			QMPControl: "/run/pod/ctrl.sock",
+			Console:    "/run/pod/console.sock",
+		},
+		NetworkNS: vc.NetworkNamespace{
+			Endpoints: []vc.Endpoint{
+				{
+					NetPair: vc.NetworkInterfacePair{
+						VirtIface: vc.NetworkInterface{Name: "eth0"},
+						TAPIface: vc.NetworkInterface{
+							Name:     "tap0",
+							HardAddr: "02:42:ac:11:00:02",
+						},
+					},
+					Properties: current.Result{
+						IPs: []*current.IPConfig{
+							{Address: *ipNet},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	container := vc.ContainerStatus{
+		ID:  "container",
+		PID: 5678,
+	}
+
+	details := getVMDetails(pod, container)
+
+	assert.Equal(vmDetails{
+		PodID:    "pod",
+		ProxyURL: "unix:///run/cc-proxy.sock",
+		ShimPid:  5678,
+		Hypervisor: vmHypervisorDetails{
+			Pid:        1234,
+			Version:    "2.7.0",
+			KernelPath: "/kernel",
+			ImagePath:  "/image",
+		},
+		VCPUs:  2,
+		Memory: 2048,
+		Sockets: vmSockets{
+			QMPMonitor: "/run/pod/monitor.sock",
+			QMPControl: "/run/pod/ctrl.sock",
+			Console:    "/run/pod/console.sock",
+		},
+		Network: []vmEndpoint{
+			{
+				Name: "eth0",
+				TAP:  "tap0",
+				MAC:  "02:42:ac:11:00:02",
+				IPs:  []string{"172.17.0.2/16"},
+			},
+		},
+	}, details)
+
+	// A pod started before the version was recorded
+	pod.State.HypervisorVersion = ""
+	details = getVMDetails(pod, container)
+	assert.Equal(unknown, details.Hypervisor.Version)
+}
+
+func TestFullStateJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	state := fullState{
+		State: specs.State{
+			Version: specs.Version,
+			ID:      "container",
+			Status:  "running",
+		},
+		ClearContainers: &vmDetails{PodID: "pod"},
+	}
+
+	data, err := json.Marshal(state)
+	assert.NoError(err)
+
+	var decoded map[string]interface{}
+	assert.NoError(json.Unmarshal(data, &decoded))
+
+	// The OCI state fields are kept at the top level.
+	assert.Equal("container", decoded["id"])
+	assert.Equal("running", decoded["status"])
+
+	details, ok := decoded["clearcontainers"].(map[string]interface{})
+	assert.True(ok)
+	assert.Equal("pod", details["podId"])
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/urfave/cli"
+)
+
+// ccStorageType is the storage used for the state of the pods, as set
+// by the configuration file.
+var ccStorageType = vc.FilesystemStorage
+
+var migrateStorageCLICommand = cli.Command{
+	Name:      "cc-migrate-storage",
+	Usage:     "move the state of the pods to another storage",
+	ArgsUsage: `<storage>`,
+	Description: `The state of the pods and containers is stored using the storage set by
+   the "storage" option of the configuration file. This command moves the
+   state of all the pods from that storage to <storage> ("filesystem" or
+   "kv"). The pods keep running. No container should be created until the
+   configuration file has been updated to use <storage>.`,
+	Action: func(context *cli.Context) error {
+		args := context.Args()
+		if len(args) != 1 {
+			return fmt.Errorf("Expecting only one storage, got %d: %v", len(args), []string(args))
+		}
+
+		var to vc.StorageType
+		if err := to.Set(args.First()); err != nil {
+			return err
+		}
+
+		return migrateStorage(ccStorageType, to, os.Stdout)
+	},
+}
+
+// handleStorage sets the storage used for the state of the pods.
+func handleStorage(storageType vc.StorageType) error {
+	if err := vc.SetStorageType(storageType); err != nil {
+		return err
+	}
+
+	ccStorageType = storageType
+
+	return nil
+}
+
+// migrateStorage moves the state of the pods from the storage from to
+// the storage to, reporting the pods moved to out.
+func migrateStorage(from, to vc.StorageType, out io.Writer) error {
+	migrated, err := vc.MigrateStorage(from, to)
+
+	for _, podID := range migrated {
+		fmt.Fprintf(out, "Moved pod %s to %s storage\n", podID, to.String())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Set storage = %q in the [runtime] section of the configuration file to use it\n", to.String())
+
+	return nil
+}
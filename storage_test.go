@@ -0,0 +1,47 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	defer handleStorage(ccStorageType)
+
+	err := handleStorage(vc.KVStorage)
+	assert.NoError(err)
+	assert.Equal(vc.KVStorage, ccStorageType)
+
+	err = handleStorage(vc.StorageType("foo"))
+	assert.Error(err)
+	assert.Equal(vc.KVStorage, ccStorageType)
+}
+
+func TestMigrateStorageSameStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	err := migrateStorage(vc.FilesystemStorage, vc.FilesystemStorage, &out)
+	assert.Error(err)
+	assert.Empty(out.String())
+}
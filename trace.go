@@ -0,0 +1,486 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+)
+
+const (
+	// traceParentEnv is the environment variable used to pass the
+	// trace context to (and from) other processes, using the W3C
+	// Trace Context "traceparent" format.
+	traceParentEnv = "TRACEPARENT"
+
+	// traceFileMode is the mode used to create the trace file.
+	traceFileMode = os.FileMode(0640)
+
+	// traceDirMode is the mode used to create the directory to hold
+	// the trace file.
+	traceDirMode = os.FileMode(0750)
+
+	// OTLP span kind and status codes.
+	otlpSpanKindInternal = 1
+	otlpStatusCodeError  = 2
+)
+
+// variables to allow tests to modify the values
+var (
+	// traceExportTimeout is the maximum time to wait for the trace
+	// collector.
+	traceExportTimeout = 2 * time.Second
+)
+
+var traceParentRegex = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// ccTracer is the tracer for runtime operations. It is nil if tracing
+// is not enabled.
+var ccTracer *tracer
+
+// tracer records spans for the runtime and virtcontainers. Spans are
+// buffered and exported when the runtime exits.
+type tracer struct {
+	sync.Mutex
+
+	endpoint string
+	file     string
+
+	traceID string
+
+	// remoteParentID is the ID of the span in the calling process
+	// (if any) that is the parent of the root span.
+	remoteParentID string
+
+	// root is the span of the runtime command, the parent of the
+	// spans started without an explicit parent.
+	root *span
+
+	// unfinished contains the spans which have not finished, which
+	// are finished when the spans are exported.
+	unfinished []*span
+
+	finished []*span
+	exported bool
+}
+
+// span is a single traced operation.
+type span struct {
+	tracer *tracer
+
+	name     string
+	id       string
+	parentID string
+	start    time.Time
+	end      time.Time
+	tags     map[string]interface{}
+	err      error
+}
+
+// handleTracing sets up tracing. If neither a collector endpoint nor a
+// trace file are specified, tracing is disabled.
+func handleTracing(endpoint, file string) error {
+	if endpoint == "" && file == "" {
+		ccTracer = nil
+		vc.SetTracer(nil)
+		return nil
+	}
+
+	if file != "" {
+		if !filepath.IsAbs(file) {
+			return fmt.Errorf("Trace file path must be absolute: %v", file)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(file), traceDirMode); err != nil {
+			return err
+		}
+	}
+
+	t, err := newTracer(endpoint, file)
+	if err != nil {
+		return err
+	}
+
+	ccTracer = t
+	vc.SetTracer(t)
+
+	return nil
+}
+
+// newTracer creates a tracer. If the trace context has been passed in
+// the environment, the spans become part of that trace.
+func newTracer(endpoint, file string) (*tracer, error) {
+	t := &tracer{
+		endpoint: endpoint,
+		file:     file,
+	}
+
+	if m := traceParentRegex.FindStringSubmatch(os.Getenv(traceParentEnv)); m != nil {
+		t.traceID = m[1]
+		t.remoteParentID = m[2]
+		return t, nil
+	}
+
+	id, err := randomTraceID(16)
+	if err != nil {
+		return nil, err
+	}
+
+	t.traceID = id
+
+	return t, nil
+}
+
+// randomTraceID returns a random ID of the specified number of bytes,
+// hex-encoded.
+func randomTraceID(size int) (string, error) {
+	b := make([]byte, size)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// StartSpan creates a new span which is a child of the parent span or,
+// if no parent is specified, of the root span. Since the runtime may
+// perform operations concurrently, the parent is never inferred from the
+// other spans which have not finished.
+func (t *tracer) StartSpan(parent vc.Span, name string) vc.Span {
+	t.Lock()
+	defer t.Unlock()
+
+	parentID := t.remoteParentID
+
+	if p, ok := parent.(*span); ok && p != nil {
+		parentID = p.id
+	} else if t.root != nil {
+		parentID = t.root.id
+	}
+
+	return t.newSpan(name, parentID)
+}
+
+// startRootSpan creates the root span, the child of the span of the
+// calling process (if any).
+func (t *tracer) startRootSpan(name string) *span {
+	t.Lock()
+	defer t.Unlock()
+
+	t.root = t.newSpan(name, t.remoteParentID)
+
+	return t.root
+}
+
+// newSpan creates a span. The caller must hold the tracer lock.
+func (t *tracer) newSpan(name, parentID string) *span {
+	s := &span{
+		tracer:   t,
+		name:     name,
+		parentID: parentID,
+		start:    time.Now(),
+		tags:     make(map[string]interface{}),
+	}
+
+	// An all-zero ID is invalid, but the chance of generating one is
+	// negligible and the span is still recorded.
+	s.id, _ = randomTraceID(8)
+
+	t.unfinished = append(t.unfinished, s)
+
+	return s
+}
+
+// SetTag attaches a key/value pair to the span.
+func (s *span) SetTag(key string, value interface{}) {
+	s.tracer.Lock()
+	defer s.tracer.Unlock()
+
+	s.tags[key] = value
+}
+
+// SetError records that the operation failed.
+func (s *span) SetError(err error) {
+	s.tracer.Lock()
+	defer s.tracer.Unlock()
+
+	s.err = err
+}
+
+// Environment returns the environment variables used to pass the span
+// context to a child process.
+func (s *span) Environment() []string {
+	return []string{fmt.Sprintf("%s=00-%s-%s-01", traceParentEnv, s.tracer.traceID, s.id)}
+}
+
+// Finish records the end of the operation.
+func (s *span) Finish() {
+	t := s.tracer
+
+	t.Lock()
+	defer t.Unlock()
+
+	if !s.end.IsZero() {
+		return
+	}
+
+	s.end = time.Now()
+
+	for i, unfinished := range t.unfinished {
+		if unfinished == s {
+			t.unfinished = append(t.unfinished[:i], t.unfinished[i+1:]...)
+			break
+		}
+	}
+
+	t.finished = append(t.finished, s)
+}
+
+// The types below implement the subset of the OpenTelemetry protocol
+// (OTLP) JSON encoding required to export spans.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// otlpValue converts a span tag value into an OTLP value.
+func otlpValue(value interface{}) otlpAnyValue {
+	switch v := value.(type) {
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s := fmt.Sprintf("%d", v)
+		return otlpAnyValue{IntValue: &s}
+	default:
+		s := fmt.Sprintf("%v", v)
+		return otlpAnyValue{StringValue: &s}
+	}
+}
+
+// otlpAttributes converts the specified tags into OTLP attributes.
+func otlpAttributes(tags map[string]interface{}) []otlpKeyValue {
+	var attrs []otlpKeyValue
+
+	for k, v := range tags {
+		attrs = append(attrs, otlpKeyValue{Key: k, Value: otlpValue(v)})
+	}
+
+	return attrs
+}
+
+// traces returns the finished spans in OTLP form.
+func (t *tracer) traces() otlpTraces {
+	var spans []otlpSpan
+
+	for _, s := range t.finished {
+		otlp := otlpSpan{
+			TraceID:           t.traceID,
+			SpanID:            s.id,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: fmt.Sprintf("%d", s.start.UnixNano()),
+			EndTimeUnixNano:   fmt.Sprintf("%d", s.end.UnixNano()),
+			Attributes:        otlpAttributes(s.tags),
+		}
+
+		if s.err != nil {
+			otlp.Status = &otlpStatus{
+				Code:    otlpStatusCodeError,
+				Message: s.err.Error(),
+			}
+		}
+
+		spans = append(spans, otlp)
+	}
+
+	return otlpTraces{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: otlpAttributes(map[string]interface{}{
+						"service.name": name,
+						"process.pid":  os.Getpid(),
+					}),
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{
+							Name:    name,
+							Version: version,
+						},
+						Spans: spans,
+					},
+				},
+			},
+		},
+	}
+}
+
+// export finishes any outstanding spans and sends all spans to the
+// collector endpoint and the trace file. Spans are only exported once.
+func (t *tracer) export() error {
+	t.Lock()
+	unfinished := append([]*span{}, t.unfinished...)
+	t.Unlock()
+
+	// Finish the most recently started spans first.
+	for i := len(unfinished) - 1; i >= 0; i-- {
+		unfinished[i].Finish()
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if t.exported || len(t.finished) == 0 {
+		return nil
+	}
+
+	t.exported = true
+
+	data, err := json.Marshal(t.traces())
+	if err != nil {
+		return err
+	}
+
+	if t.file != "" {
+		if err := appendTraceFile(t.file, data); err != nil {
+			return err
+		}
+	}
+
+	if t.endpoint != "" {
+		if err := postTraces(t.endpoint, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendTraceFile appends the specified traces to the trace file as a
+// single line.
+func appendTraceFile(file string, data []byte) error {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, traceFileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+
+	return err
+}
+
+// postTraces sends the specified traces to an OTLP/HTTP collector
+// endpoint.
+func postTraces(endpoint string, data []byte) error {
+	client := &http.Client{
+		Timeout: traceExportTimeout,
+	}
+
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Trace collector %v returned status %v", endpoint, resp.Status)
+	}
+
+	return nil
+}
+
+// startTrace starts the root span for the specified command.
+func startTrace(command string) {
+	if ccTracer == nil {
+		return
+	}
+
+	span := ccTracer.startRootSpan(command)
+	span.SetTag("pid", os.Getpid())
+}
+
+// exportTrace exports the spans recorded by the runtime. Failure is
+// logged but does not cause the runtime to fail.
+func exportTrace() {
+	if ccTracer == nil {
+		return
+	}
+
+	if err := ccTracer.export(); err != nil {
+		ccLog.Warnf("Failed to export trace: %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testTraceID      = "0af7651916cd43dd8448eb211c80319c"
+	testTraceSpanID  = "b7ad6b7169203331"
+	testTraceContext = "00-" + testTraceID + "-" + testTraceSpanID + "-01"
+)
+
+// saveTestTracer returns a function that restores the tracer.
+func saveTestTracer() func() {
+	savedTracer := ccTracer
+
+	return func() {
+		ccTracer = savedTracer
+		if savedTracer == nil {
+			vc.SetTracer(nil)
+		} else {
+			vc.SetTracer(savedTracer)
+		}
+	}
+}
+
+func testTraceSpans(t *testing.T, data []byte) []otlpSpan {
+	var traces otlpTraces
+
+	err := json.Unmarshal(data, &traces)
+	assert.NoError(t, err)
+	assert.Len(t, traces.ResourceSpans, 1)
+	assert.Len(t, traces.ResourceSpans[0].ScopeSpans, 1)
+
+	return traces.ResourceSpans[0].ScopeSpans[0].Spans
+}
+
+func TestHandleTracing(t *testing.T) {
+	assert := assert.New(t)
+
+	defer saveTestTracer()()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	err = handleTracing("", "")
+	assert.NoError(err)
+	assert.Nil(ccTracer)
+
+	err = handleTracing("", "trace.json")
+	assert.Error(err)
+	assert.Nil(ccTracer)
+
+	file := filepath.Join(tmpdir, "a", "trace.json")
+
+	err = handleTracing("", file)
+	assert.NoError(err)
+	assert.NotNil(ccTracer)
+	assert.Equal(file, ccTracer.file)
+	assert.True(fileExists(filepath.Dir(file)))
+
+	// virtcontainers uses the same tracer
+	parent, ctx := vc.StartSpan(context.Background(), "foo")
+	child, _ := vc.StartSpan(ctx, "bar")
+	child.Finish()
+	parent.Finish()
+	assert.Len(ccTracer.finished, 2)
+	assert.Equal(parent.(*span).id, child.(*span).parentID)
+}
+
+func TestNewTracer(t *testing.T) {
+	assert := assert.New(t)
+
+	saved := os.Getenv(traceParentEnv)
+	defer os.Setenv(traceParentEnv, saved)
+
+	os.Setenv(traceParentEnv, "")
+
+	tr, err := newTracer("", "")
+	assert.NoError(err)
+	assert.Len(tr.traceID, 32)
+	assert.Empty(tr.remoteParentID)
+
+	os.Setenv(traceParentEnv, testTraceContext)
+
+	tr, err = newTracer("", "")
+	assert.NoError(err)
+	assert.Equal(testTraceID, tr.traceID)
+	assert.Equal(testTraceSpanID, tr.remoteParentID)
+
+	// invalid trace contexts are ignored
+	os.Setenv(traceParentEnv, "00-foo-bar-01")
+
+	tr, err = newTracer("", "")
+	assert.NoError(err)
+	assert.NotEqual(testTraceID, tr.traceID)
+	assert.Empty(tr.remoteParentID)
+}
+
+func TestTracerSpans(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := &tracer{
+		traceID:        testTraceID,
+		remoteParentID: testTraceSpanID,
+	}
+
+	// no root span yet
+	orphan := tr.StartSpan(nil, "orphan").(*span)
+	assert.Equal(testTraceSpanID, orphan.parentID)
+	orphan.Finish()
+
+	root := tr.startRootSpan("root")
+	assert.Equal(testTraceSpanID, root.parentID)
+	assert.Len(root.id, 16)
+
+	child := tr.StartSpan(nil, "child").(*span)
+	assert.Equal(root.id, child.parentID)
+	assert.Equal([]string{traceParentEnv + "=00-" + testTraceID + "-" + child.id + "-01"}, child.Environment())
+
+	grandchild := tr.StartSpan(child, "grandchild").(*span)
+	assert.Equal(child.id, grandchild.parentID)
+	grandchild.Finish()
+
+	child.SetTag("pod", "foo")
+	child.SetError(errors.New("child failed"))
+	child.Finish()
+
+	// finishing twice has no effect
+	child.Finish()
+
+	sibling := tr.StartSpan(nil, "sibling").(*span)
+	assert.Equal(root.id, sibling.parentID)
+	sibling.Finish()
+
+	root.Finish()
+
+	assert.Empty(tr.unfinished)
+	assert.Len(tr.finished, 5)
+	assert.Equal(map[string]interface{}{"pod": "foo"}, child.tags)
+	assert.False(child.end.Before(child.start))
+}
+
+// TestTracerConcurrentSpans checks that the spans of concurrent
+// operations are not parented to each other.
+func TestTracerConcurrentSpans(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := &tracer{
+		traceID: testTraceID,
+	}
+
+	root := tr.startRootSpan("delete")
+
+	const workers = 8
+
+	var wg sync.WaitGroup
+	children := make([]*span, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			parent := tr.StartSpan(nil, "deleteContainer")
+			child := tr.StartSpan(parent, "stopContainer")
+
+			children[i] = child.(*span)
+			assert.Equal(parent.(*span).id, children[i].parentID)
+
+			child.Finish()
+			parent.Finish()
+
+			assert.Equal(root.id, parent.(*span).parentID)
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.Len(tr.finished, 2*workers)
+}
+
+func TestTracerExportFile(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	file := filepath.Join(tmpdir, "trace.json")
+
+	tr := &tracer{
+		traceID: testTraceID,
+		file:    file,
+	}
+
+	// nothing to export
+	err = tr.export()
+	assert.NoError(err)
+	assert.False(fileExists(file))
+
+	root := tr.startRootSpan("root")
+	child := tr.StartSpan(nil, "child")
+	child.SetTag("count", 3)
+	child.SetTag("ok", true)
+	child.SetError(errors.New("child failed"))
+	child.Finish()
+
+	// unfinished spans are finished by the export
+	err = tr.export()
+	assert.NoError(err)
+
+	// spans are only exported once
+	err = tr.export()
+	assert.NoError(err)
+
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(lines, 1)
+
+	spans := testTraceSpans(t, []byte(lines[0]))
+	assert.Len(spans, 2)
+
+	c := spans[0]
+	assert.Equal("child", c.Name)
+	assert.Equal(testTraceID, c.TraceID)
+	assert.Equal(root.id, c.ParentSpanID)
+	assert.Equal(otlpSpanKindInternal, c.Kind)
+	assert.NotNil(c.Status)
+	assert.Equal(otlpStatusCodeError, c.Status.Code)
+	assert.Equal("child failed", c.Status.Message)
+	assert.Len(c.Attributes, 2)
+
+	r := spans[1]
+	assert.Equal("root", r.Name)
+	assert.Empty(r.ParentSpanID)
+	assert.Nil(r.Status)
+}
+
+func TestTracerExportEndpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	var received []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("POST", r.Method)
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+
+		received, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	tr := &tracer{
+		traceID:  testTraceID,
+		endpoint: server.URL,
+	}
+
+	tr.StartSpan(nil, "create").Finish()
+
+	err := tr.export()
+	assert.NoError(err)
+
+	spans := testTraceSpans(t, received)
+	assert.Len(spans, 1)
+	assert.Equal("create", spans[0].Name)
+
+	// collector errors are reported
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	tr = &tracer{
+		traceID:  testTraceID,
+		endpoint: failing.URL,
+	}
+
+	tr.StartSpan(nil, "create").Finish()
+
+	err = tr.export()
+	assert.Error(err)
+}
+
+func TestOTLPValue(t *testing.T) {
+	assert := assert.New(t)
+
+	v := otlpValue("foo")
+	assert.Equal("foo", *v.StringValue)
+
+	v = otlpValue(uint32(7))
+	assert.Equal("7", *v.IntValue)
+
+	v = otlpValue(true)
+	assert.True(*v.BoolValue)
+
+	v = otlpValue(errors.New("bar"))
+	assert.Equal("bar", *v.StringValue)
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"syscall"
+)
+
+// exitStatus returns the exit status of a process in the form used by
+// shells: the exit code if the process exited, or 128+N if the process
+// was killed by signal N.
+func exitStatus(ws syscall.WaitStatus) int {
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+
+	return ws.ExitStatus()
+}
+
+// waitShim waits for the shim with the specified PID, which must be a
+// child of the runtime, to exit and returns the exit status of the
+// process in the guest it represents: the shim exits with the exit code
+// reported by hyperstart for the process, which is 128+N if the process
+// was killed by signal N.
+//
+// The exit status of the process cannot be retrieved if the shim is
+// not a child of the runtime, and is not known if the shim itself was
+// killed by a signal, so an error is returned in these cases rather
+// than an exit status which is not that of the process.
+func waitShim(pid int) (int, error) {
+	var ws syscall.WaitStatus
+
+	for {
+		_, err := syscall.Wait4(pid, &ws, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+
+		if err == syscall.ECHILD {
+			return -1, fmt.Errorf("Shim %d is not a child of the runtime so the exit status of the process is unknown", pid)
+		}
+
+		if err != nil {
+			return -1, err
+		}
+
+		if ws.Signaled() {
+			return -1, fmt.Errorf("Shim %d was killed by signal %v so the exit status of the process is unknown", pid, ws.Signal())
+		}
+
+		return ws.ExitStatus(), nil
+	}
+}
+
+// processRunning determines if the process with the specified PID
+// exists and has not exited (zombie processes have exited).
+func processRunning(pid int) bool {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+
+	// The state follows the command name, which is in parentheses
+	// and may itself contain spaces and parentheses.
+	stat := string(data)
+
+	i := strings.LastIndex(stat, ")")
+	if i < 0 || i+2 >= len(stat) {
+		return false
+	}
+
+	state := stat[i+2]
+
+	return state != 'Z' && state != 'X'
+}
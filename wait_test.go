@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitShimExitCode(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := exec.Command("sh", "-c", "exit 3")
+	err := cmd.Start()
+	assert.NoError(err)
+
+	status, err := waitShim(cmd.Process.Pid)
+	assert.NoError(err)
+	assert.Equal(3, status)
+}
+
+func TestWaitShimSignal(t *testing.T) {
+	assert := assert.New(t)
+
+	// The exit status of the process in the guest is not known if the
+	// shim is killed.
+	cmd := exec.Command("sh", "-c", "kill -TERM $$")
+	err := cmd.Start()
+	assert.NoError(err)
+
+	_, err = waitShim(cmd.Process.Pid)
+	assert.Error(err)
+
+	// A process killed by a signal is reported by hyperstart as 128+N,
+	// which the shim exits with.
+	cmd = exec.Command("sh", "-c", "exit 143")
+	err = cmd.Start()
+	assert.NoError(err)
+
+	status, err := waitShim(cmd.Process.Pid)
+	assert.NoError(err)
+	assert.Equal(128+int(syscall.SIGTERM), status)
+}
+
+func TestWaitShimNonChild(t *testing.T) {
+	assert := assert.New(t)
+
+	// The background process is reparented when the shell exits.
+	out, err := exec.Command("sh", "-c", "sleep 0.5 >/dev/null & echo $!").Output()
+	assert.NoError(err)
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	assert.NoError(err)
+
+	_, err = waitShim(pid)
+	assert.Error(err)
+}
+
+func TestProcessRunning(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(processRunning(os.Getpid()))
+
+	cmd := exec.Command("true")
+	err := cmd.Start()
+	assert.NoError(err)
+
+	// wait for the process to become a zombie
+	for i := 0; i < 100 && processRunning(cmd.Process.Pid); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.False(processRunning(cmd.Process.Pid))
+
+	cmd.Wait()
+
+	assert.False(processRunning(cmd.Process.Pid))
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"golang.org/x/sys/unix"
+)
+
+// variables to allow tests to modify the values
+var (
+	// winsizeProcess resizes the terminal of a process in the guest.
+	winsizeProcess = vc.WinsizeProcess
+
+	// winsizePollInterval is how often the size of a terminal is
+	// checked. This is required since the runtime is not sent
+	// SIGWINCH when the size of a terminal created with
+	// --console-socket changes.
+	winsizePollInterval = 500 * time.Millisecond
+)
+
+// openWinsizeTerminal returns the terminal whose size should be
+// forwarded to the guest for a foreground process: the console if one
+// was specified, else the standard input of the runtime if it is a
+// terminal. Nil is returned if there is no such terminal.
+func openWinsizeTerminal(console string) (*os.File, error) {
+	if console != "" {
+		return os.OpenFile(console, os.O_RDONLY|unix.O_NOCTTY, 0)
+	}
+
+	if isTerminal(os.Stdin.Fd()) {
+		return os.Stdin, nil
+	}
+
+	return nil, nil
+}
+
+// watchWinsize forwards the size of the specified terminal to the
+// guest process identified by token (or the container process if token
+// is empty), initially and then whenever it changes, until the
+// returned function is called.
+//
+// Failure to resize the guest terminal is logged but is not fatal.
+func watchWinsize(podID, containerID, token string, terminal *os.File) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGWINCH)
+
+	go func() {
+		defer close(finished)
+		defer signal.Stop(sigCh)
+
+		var current winsize
+
+		for {
+			ws, err := getWinsize(terminal)
+			if err != nil {
+				ccLog.Warnf("Failed to get terminal size: %v", err)
+				return
+			}
+
+			if ws.Height != current.Height || ws.Width != current.Width {
+				if err := winsizeProcess(podID, containerID, token, ws.Height, ws.Width); err != nil {
+					ccLog.Warnf("Failed to resize terminal of container %v: %v", containerID, err)
+				}
+
+				current = ws
+			}
+
+			select {
+			case <-done:
+				return
+			case <-sigCh:
+			case <-time.After(winsizePollInterval):
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// forwardWinsize forwards the size of the terminal of a foreground
+// process (see openWinsizeTerminal) to the guest process until the
+// returned function is called.
+func forwardWinsize(podID, containerID, token, console string) (stop func()) {
+	terminal, err := openWinsizeTerminal(console)
+	if err != nil {
+		ccLog.Warnf("Failed to open terminal %v: %v", console, err)
+		return func() {}
+	}
+
+	if terminal == nil {
+		return func() {}
+	}
+
+	stopWatching := watchWinsize(podID, containerID, token, terminal)
+
+	return func() {
+		stopWatching()
+
+		if terminal != os.Stdin {
+			terminal.Close()
+		}
+	}
+}
+
+// setInitialWinsize sets the size of the terminal of the specified
+// container process to the console size specified in its OCI
+// configuration (if any) since its terminal is otherwise created with
+// a default size.
+//
+// This is the only size set by the runtime for a detached container
+// (see "Resizing the terminal of a detached container" in
+// docs/limitations.md).
+//
+// Failure is logged but is not fatal.
+func setInitialWinsize(podID string, status vc.ContainerStatus) {
+	ociSpec, err := oci.GetOCIConfig(status)
+	if err != nil {
+		ccLog.Warnf("Failed to get OCI configuration of container %v: %v", status.ID, err)
+		return
+	}
+
+	if ociSpec.Process == nil || !ociSpec.Process.Terminal {
+		return
+	}
+
+	size := ociSpec.Process.ConsoleSize
+	if size.Height == 0 || size.Width == 0 {
+		return
+	}
+
+	if err := winsizeProcess(podID, status.ID, "", uint16(size.Height), uint16(size.Width)); err != nil {
+		ccLog.Warnf("Failed to resize terminal of container %v: %v", status.ID, err)
+	}
+}
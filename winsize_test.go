@@ -0,0 +1,148 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vc "github.com/containers/virtcontainers"
+	"github.com/containers/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+type testWinsizeCall struct {
+	podID       string
+	containerID string
+	token       string
+	height      uint16
+	width       uint16
+}
+
+// setTestWinsizeProcess replaces the function used to resize guest
+// terminals with one that records the calls made. It returns the
+// channel the calls are sent to and a function to restore the
+// original.
+func setTestWinsizeProcess() (chan testWinsizeCall, func()) {
+	savedWinsizeProcess := winsizeProcess
+	savedInterval := winsizePollInterval
+
+	calls := make(chan testWinsizeCall, 10)
+
+	winsizeProcess = func(podID, containerID, token string, height, width uint16) error {
+		calls <- testWinsizeCall{podID, containerID, token, height, width}
+		return nil
+	}
+
+	winsizePollInterval = 10 * time.Millisecond
+
+	return calls, func() {
+		winsizeProcess = savedWinsizeProcess
+		winsizePollInterval = savedInterval
+	}
+}
+
+func waitTestWinsizeCall(t *testing.T, calls chan testWinsizeCall) testWinsizeCall {
+	select {
+	case call := <-calls:
+		return call
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for terminal resize")
+	}
+
+	return testWinsizeCall{}
+}
+
+func TestWatchWinsize(t *testing.T) {
+	assert := assert.New(t)
+
+	calls, restore := setTestWinsizeProcess()
+	defer restore()
+
+	console, err := newConsole()
+	assert.NoError(err)
+	defer console.Close()
+
+	err = setWinsize(console.File(), winsize{Height: 24, Width: 80})
+	assert.NoError(err)
+
+	stop := forwardWinsize("pod", "container", "token", console.Path())
+
+	call := waitTestWinsizeCall(t, calls)
+	assert.Equal(testWinsizeCall{"pod", "container", "token", 24, 80}, call)
+
+	err = setWinsize(console.File(), winsize{Height: 50, Width: 200})
+	assert.NoError(err)
+
+	call = waitTestWinsizeCall(t, calls)
+	assert.Equal(testWinsizeCall{"pod", "container", "token", 50, 200}, call)
+
+	stop()
+
+	// unchanged sizes are not forwarded
+	assert.Empty(calls)
+}
+
+func TestForwardWinsizeInvalidConsole(t *testing.T) {
+	calls, restore := setTestWinsizeProcess()
+	defer restore()
+
+	stop := forwardWinsize("pod", "container", "", "/does/not/exist")
+	stop()
+
+	assert.Empty(t, calls)
+}
+
+func TestSetInitialWinsize(t *testing.T) {
+	assert := assert.New(t)
+
+	calls, restore := setTestWinsizeProcess()
+	defer restore()
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	configPath := filepath.Join(tmpdir, "config.json")
+
+	status := vc.ContainerStatus{
+		ID: "container",
+		Annotations: map[string]string{
+			oci.ConfigPathKey: configPath,
+		},
+	}
+
+	for _, config := range []string{
+		`{"process": {"terminal": false, "consoleSize": {"height": 40, "width": 100}}}`,
+		`{"process": {"terminal": true}}`,
+	} {
+		err = ioutil.WriteFile(configPath, []byte(config), testFileMode)
+		assert.NoError(err)
+
+		setInitialWinsize("pod", status)
+		assert.Empty(calls, "config %s", config)
+	}
+
+	err = ioutil.WriteFile(configPath, []byte(`{"process": {"terminal": true, "consoleSize": {"height": 40, "width": 100}}}`), testFileMode)
+	assert.NoError(err)
+
+	setInitialWinsize("pod", status)
+
+	call := waitTestWinsizeCall(t, calls)
+	assert.Equal(testWinsizeCall{"pod", "container", "", 40, 100}, call)
+}